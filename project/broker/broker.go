@@ -0,0 +1,25 @@
+package broker
+
+import (
+	"context"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Broker carries messages between publishers and consumer groups. Every
+// consumer group receives each message published to a topic once, and
+// subscribers sharing a consumer group split the messages between them.
+type Broker interface {
+	Publisher() message.Publisher
+	NewSubscriber(consumerGroup string) (message.Subscriber, error)
+
+	Messages(ctx context.Context, topic string) ([]StoredMessage, error)
+	Message(ctx context.Context, topic, id string) (StoredMessage, bool, error)
+	DeleteMessage(ctx context.Context, topic, id string) (bool, error)
+}
+
+// StoredMessage is a message kept in a topic, identified by a broker-specific ID.
+type StoredMessage struct {
+	ID      string
+	Message *message.Message
+}
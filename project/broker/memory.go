@@ -0,0 +1,336 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Memory is an in-process broker. Topics keep every published message for the
+// lifetime of the process, and each consumer group tracks its own offset in
+// the topic, starting from the oldest message like a new Redis consumer group.
+// The offset only moves past a message once it is acked: a message that is
+// nacked, or in flight when its subscriber stops, is redelivered to the group.
+type Memory struct {
+	mu     sync.Mutex
+	topics map[string]*memoryTopic
+}
+
+type memoryTopic struct {
+	entries []*memoryEntry
+	lastID  uint64
+	groups  map[string]*memoryGroup
+	// changed is closed and replaced whenever a message becomes available.
+	changed chan struct{}
+}
+
+// memoryGroup is a consumer group's progress in a topic. offset is the index
+// of the oldest entry the group hasn't acked; entries after it may be in
+// flight with one of the group's subscribers, or already acked.
+type memoryGroup struct {
+	offset   int
+	inFlight map[int]bool
+	acked    map[int]bool
+}
+
+type memoryEntry struct {
+	StoredMessage
+	deleted bool
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		topics: map[string]*memoryTopic{},
+	}
+}
+
+func (m *Memory) Publisher() message.Publisher {
+	return memoryPublisher{broker: m}
+}
+
+func (m *Memory) NewSubscriber(consumerGroup string) (message.Subscriber, error) {
+	if consumerGroup == "" {
+		return nil, errors.New("consumer group is required")
+	}
+
+	return &memorySubscriber{
+		broker:        m,
+		consumerGroup: consumerGroup,
+		closing:       make(chan struct{}),
+	}, nil
+}
+
+func (m *Memory) Messages(_ context.Context, topic string) ([]StoredMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var messages []StoredMessage
+	for _, e := range m.topic(topic).entries {
+		if !e.deleted {
+			messages = append(messages, StoredMessage{ID: e.ID, Message: e.Message.Copy()})
+		}
+	}
+
+	return messages, nil
+}
+
+func (m *Memory) Message(_ context.Context, topic, id string) (StoredMessage, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.topic(topic).entry(id)
+	if !ok {
+		return StoredMessage{}, false, nil
+	}
+
+	return StoredMessage{ID: e.ID, Message: e.Message.Copy()}, true, nil
+}
+
+func (m *Memory) DeleteMessage(_ context.Context, topic, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.topic(topic).entry(id)
+	if !ok {
+		return false, nil
+	}
+
+	e.deleted = true
+
+	return true, nil
+}
+
+// topic must be called with m.mu held.
+func (m *Memory) topic(name string) *memoryTopic {
+	t, ok := m.topics[name]
+	if !ok {
+		t = &memoryTopic{
+			groups:  map[string]*memoryGroup{},
+			changed: make(chan struct{}),
+		}
+		m.topics[name] = t
+	}
+
+	return t
+}
+
+func (m *Memory) publish(topic string, messages []*message.Message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.topic(topic)
+	for _, msg := range messages {
+		t.lastID++
+		t.entries = append(t.entries, &memoryEntry{
+			StoredMessage: StoredMessage{
+				ID:      strconv.FormatUint(t.lastID, 10),
+				Message: msg.Copy(),
+			},
+		})
+	}
+
+	t.notify()
+}
+
+// next claims the oldest message in the topic that the consumer group hasn't
+// acked and none of its subscribers has in flight, waiting until one is
+// available. It returns the message's index in the topic.
+func (m *Memory) next(ctx context.Context, closing <-chan struct{}, topic, consumerGroup string) (int, *memoryEntry, bool) {
+	for {
+		m.mu.Lock()
+		t := m.topic(topic)
+		g := t.group(consumerGroup)
+		for i := g.offset; i < len(t.entries); i++ {
+			e := t.entries[i]
+			if e.deleted || g.inFlight[i] || g.acked[i] {
+				continue
+			}
+
+			g.inFlight[i] = true
+			m.mu.Unlock()
+			return i, e, true
+		}
+		changed := t.changed
+		m.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return 0, nil, false
+		case <-closing:
+			return 0, nil, false
+		}
+	}
+}
+
+// ack moves the consumer group's offset past the message, and past any acked
+// or deleted messages that follow it.
+func (m *Memory) ack(topic, consumerGroup string, i int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.topic(topic)
+	g := t.group(consumerGroup)
+	delete(g.inFlight, i)
+	if i < g.offset {
+		return
+	}
+	g.acked[i] = true
+
+	for g.offset < len(t.entries) && (g.acked[g.offset] || t.entries[g.offset].deleted) {
+		delete(g.acked, g.offset)
+		g.offset++
+	}
+}
+
+// release hands the message back to the consumer group without acking it, so
+// it is redelivered.
+func (m *Memory) release(topic, consumerGroup string, i int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.topic(topic)
+	delete(t.group(consumerGroup).inFlight, i)
+	t.notify()
+}
+
+// group must be called with m.mu held.
+func (t *memoryTopic) group(name string) *memoryGroup {
+	g, ok := t.groups[name]
+	if !ok {
+		g = &memoryGroup{
+			inFlight: map[int]bool{},
+			acked:    map[int]bool{},
+		}
+		t.groups[name] = g
+	}
+
+	return g
+}
+
+// notify wakes up subscribers waiting for a message. It must be called with
+// m.mu held.
+func (t *memoryTopic) notify() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+func (t *memoryTopic) entry(id string) (*memoryEntry, bool) {
+	for _, e := range t.entries {
+		if e.ID == id && !e.deleted {
+			return e, true
+		}
+	}
+
+	return nil, false
+}
+
+type memoryPublisher struct {
+	broker *Memory
+}
+
+func (p memoryPublisher) Publish(topic string, messages ...*message.Message) error {
+	p.broker.publish(topic, messages)
+
+	return nil
+}
+
+func (p memoryPublisher) Close() error {
+	return nil
+}
+
+type memorySubscriber struct {
+	broker        *Memory
+	consumerGroup string
+
+	closeOnce sync.Once
+	closing   chan struct{}
+	wg        sync.WaitGroup
+}
+
+func (s *memorySubscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	select {
+	case <-s.closing:
+		return nil, errors.New("subscriber closed")
+	default:
+	}
+
+	out := make(chan *message.Message)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(out)
+
+		for {
+			i, e, ok := s.broker.next(ctx, s.closing, topic, s.consumerGroup)
+			if !ok {
+				return
+			}
+
+			acked := s.deliver(ctx, out, e)
+			if acked {
+				s.broker.ack(topic, s.consumerGroup, i)
+				continue
+			}
+
+			s.broker.release(topic, s.consumerGroup, i)
+			if !s.running(ctx) {
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// deliver sends the message and reports whether it was acked. It returns false
+// if the message was nacked or the subscriber stopped before it was acked.
+func (s *memorySubscriber) deliver(ctx context.Context, out chan<- *message.Message, e *memoryEntry) bool {
+	msg := e.Message.Copy()
+	msgCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	msg.SetContext(msgCtx)
+
+	select {
+	case out <- msg:
+	case <-ctx.Done():
+		return false
+	case <-s.closing:
+		return false
+	}
+
+	select {
+	case <-msg.Acked():
+		return true
+	case <-msg.Nacked():
+		return false
+	case <-ctx.Done():
+		return false
+	case <-s.closing:
+		return false
+	}
+}
+
+func (s *memorySubscriber) running(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-s.closing:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *memorySubscriber) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closing)
+	})
+	s.wg.Wait()
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package broker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"tickets/broker"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory_consumerGroups(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	b := broker.NewMemory()
+	topic := "topic-" + uuid.NewString()
+
+	first := publish(t, b, topic)
+
+	groupA1 := subscribe(t, ctx, b, "group-a", topic)
+	groupB := subscribe(t, ctx, b, "group-b", topic)
+
+	assert.Equal(t, first.UUID, receive(t, groupB).UUID)
+
+	msg := receive(t, groupA1)
+	assert.Equal(t, first.UUID, msg.UUID)
+	msg.Nack()
+
+	msg = receive(t, groupA1)
+	assert.Equal(t, first.UUID, msg.UUID, "nacked message should be redelivered")
+	msg.Ack()
+
+	groupA2 := subscribe(t, ctx, b, "group-a", topic)
+	second := publish(t, b, topic)
+
+	select {
+	case msg = <-groupA1:
+	case msg = <-groupA2:
+	case <-time.After(time.Second):
+		require.FailNow(t, "message not delivered to group-a")
+	}
+	assert.Equal(t, second.UUID, msg.UUID)
+	msg.Ack()
+
+	select {
+	case msg = <-groupA1:
+		assert.Fail(t, "message delivered twice to group-a", msg.UUID)
+	case msg = <-groupA2:
+		assert.Fail(t, "message delivered twice to group-a", msg.UUID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMemory_redeliverInFlight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	b := broker.NewMemory()
+	topic := "topic-" + uuid.NewString()
+
+	first := publish(t, b, topic)
+	second := publish(t, b, topic)
+
+	stoppedCtx, stop := context.WithCancel(ctx)
+	stopped := subscribe(t, stoppedCtx, b, "group", topic)
+	assert.Equal(t, first.UUID, receive(t, stopped).UUID)
+
+	closed, err := b.NewSubscriber("group")
+	require.NoError(t, err)
+	closedMessages, err := closed.Subscribe(ctx, topic)
+	require.NoError(t, err)
+	assert.Equal(t, second.UUID, receive(t, closedMessages).UUID, "message in flight should not be delivered twice")
+
+	// Neither message is acked before its subscriber stops.
+	stop()
+	require.NoError(t, closed.Close())
+	require.Eventually(t, func() bool {
+		_, open := <-stopped
+		return !open
+	}, time.Second, 10*time.Millisecond, "stopped subscriber should close its channel")
+
+	running := subscribe(t, ctx, b, "group", topic)
+
+	msg := receive(t, running)
+	assert.Equal(t, first.UUID, msg.UUID, "message in flight when the subscriber stopped should be redelivered")
+	msg.Ack()
+
+	msg = receive(t, running)
+	assert.Equal(t, second.UUID, msg.UUID, "message in flight when the subscriber closed should be redelivered")
+	msg.Nack()
+
+	msg = receive(t, running)
+	assert.Equal(t, second.UUID, msg.UUID, "nacked message should be redelivered")
+	msg.Ack()
+
+	select {
+	case msg = <-running:
+		assert.Fail(t, "acked message delivered again", msg.UUID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMemory_deleteMessage(t *testing.T) {
+	ctx := context.Background()
+
+	b := broker.NewMemory()
+	topic := "topic-" + uuid.NewString()
+
+	msg := publish(t, b, topic)
+
+	messages, err := b.Messages(ctx, topic)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, msg.UUID, messages[0].Message.UUID)
+
+	stored, ok, err := b.Message(ctx, topic, messages[0].ID)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, msg.UUID, stored.Message.UUID)
+
+	deleted, err := b.DeleteMessage(ctx, topic, messages[0].ID)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	_, ok, err = b.Message(ctx, topic, messages[0].ID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	deleted, err = b.DeleteMessage(ctx, topic, messages[0].ID)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+}
+
+func publish(t *testing.T, b broker.Broker, topic string) *message.Message {
+	t.Helper()
+
+	msg := message.NewMessage(uuid.NewString(), []byte(`{}`))
+	require.NoError(t, b.Publisher().Publish(topic, msg))
+
+	return msg
+}
+
+func subscribe(t *testing.T, ctx context.Context, b broker.Broker, consumerGroup, topic string) <-chan *message.Message {
+	t.Helper()
+
+	sub, err := b.NewSubscriber(consumerGroup)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, sub.Close())
+	})
+
+	messages, err := sub.Subscribe(ctx, topic)
+	require.NoError(t, err)
+
+	return messages
+}
+
+func receive(t *testing.T, messages <-chan *message.Message) *message.Message {
+	t.Helper()
+
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(time.Second):
+		require.FailNow(t, "message not delivered")
+		return nil
+	}
+}
@@ -0,0 +1,100 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/redis/go-redis/v9"
+)
+
+type Redis struct {
+	rdb         *redis.Client
+	publisher   *redisstream.Publisher
+	unmarshaler redisstream.Unmarshaller
+	logger      watermill.LoggerAdapter
+}
+
+func NewRedis(rdb *redis.Client, logger watermill.LoggerAdapter) (*Redis, error) {
+	publisher, err := redisstream.NewPublisher(redisstream.PublisherConfig{
+		Client: rdb,
+	}, logger)
+	if err != nil {
+		return nil, fmt.Errorf("creating publisher: %w", err)
+	}
+
+	return &Redis{
+		rdb:         rdb,
+		publisher:   publisher,
+		unmarshaler: redisstream.DefaultMarshallerUnmarshaller{},
+		logger:      logger,
+	}, nil
+}
+
+func (r *Redis) Publisher() message.Publisher {
+	return r.publisher
+}
+
+func (r *Redis) NewSubscriber(consumerGroup string) (message.Subscriber, error) {
+	return redisstream.NewSubscriber(redisstream.SubscriberConfig{
+		Client:        r.rdb,
+		ConsumerGroup: consumerGroup,
+	}, r.logger)
+}
+
+func (r *Redis) Messages(ctx context.Context, topic string) ([]StoredMessage, error) {
+	entries, err := r.rdb.XRange(ctx, topic, "-", "+").Result()
+	if err != nil {
+		return nil, fmt.Errorf("reading stream %s: %w", topic, err)
+	}
+
+	messages := make([]StoredMessage, 0, len(entries))
+	for _, entry := range entries {
+		msg, err := r.toStoredMessage(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+func (r *Redis) Message(ctx context.Context, topic, id string) (StoredMessage, bool, error) {
+	entries, err := r.rdb.XRange(ctx, topic, id, id).Result()
+	if err != nil {
+		return StoredMessage{}, false, fmt.Errorf("reading message %s from stream %s: %w", id, topic, err)
+	}
+
+	if len(entries) == 0 {
+		return StoredMessage{}, false, nil
+	}
+
+	msg, err := r.toStoredMessage(entries[0])
+	if err != nil {
+		return StoredMessage{}, false, err
+	}
+
+	return msg, true, nil
+}
+
+func (r *Redis) DeleteMessage(ctx context.Context, topic, id string) (bool, error) {
+	n, err := r.rdb.XDel(ctx, topic, id).Result()
+	if err != nil {
+		return false, fmt.Errorf("deleting message %s from stream %s: %w", id, topic, err)
+	}
+
+	return n > 0, nil
+}
+
+func (r *Redis) toStoredMessage(entry redis.XMessage) (StoredMessage, error) {
+	msg, err := r.unmarshaler.Unmarshal(entry.Values)
+	if err != nil {
+		return StoredMessage{}, fmt.Errorf("unmarshaling message %s: %w", entry.ID, err)
+	}
+
+	return StoredMessage{ID: entry.ID, Message: msg}, nil
+}
@@ -0,0 +1,164 @@
+package broker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	watermillSQL "github.com/ThreeDotsLabs/watermill-sql/v2/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/jmoiron/sqlx"
+)
+
+const sqlPollInterval = 100 * time.Millisecond
+
+// SQL uses Postgres tables as topics, one per topic, with consumer group
+// offsets kept in watermill's offsets tables. It shares the service database,
+// so events published in a transaction need no outbox.
+type SQL struct {
+	db        *sqlx.DB
+	publisher *watermillSQL.Publisher
+	schema    watermillSQL.DefaultPostgreSQLSchema
+	logger    watermill.LoggerAdapter
+}
+
+func NewSQL(db *sqlx.DB, logger watermill.LoggerAdapter) (*SQL, error) {
+	schema := watermillSQL.DefaultPostgreSQLSchema{}
+
+	publisher, err := watermillSQL.NewPublisher(db, watermillSQL.PublisherConfig{
+		SchemaAdapter:        schema,
+		AutoInitializeSchema: true,
+	}, logger)
+	if err != nil {
+		return nil, fmt.Errorf("creating publisher: %w", err)
+	}
+
+	return &SQL{
+		db:        db,
+		publisher: publisher,
+		schema:    schema,
+		logger:    logger,
+	}, nil
+}
+
+func (s *SQL) Publisher() message.Publisher {
+	return s.publisher
+}
+
+func (s *SQL) NewSubscriber(consumerGroup string) (message.Subscriber, error) {
+	return watermillSQL.NewSubscriber(s.db, watermillSQL.SubscriberConfig{
+		ConsumerGroup:    consumerGroup,
+		SchemaAdapter:    s.schema,
+		OffsetsAdapter:   watermillSQL.DefaultPostgreSQLOffsetsAdapter{},
+		PollInterval:     sqlPollInterval,
+		InitializeSchema: true,
+	}, s.logger)
+}
+
+func (s *SQL) Messages(ctx context.Context, topic string) ([]StoredMessage, error) {
+	if err := s.initializeTopic(ctx, topic); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT "offset", uuid, payload, metadata
+		FROM `+s.schema.MessagesTable(topic)+` ORDER BY "offset"`)
+	if err != nil {
+		return nil, fmt.Errorf("querying topic %s: %w", topic, err)
+	}
+	defer rows.Close()
+
+	var messages []StoredMessage
+	for rows.Next() {
+		msg, err := scanStoredMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+func (s *SQL) Message(ctx context.Context, topic, id string) (StoredMessage, bool, error) {
+	offset, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return StoredMessage{}, false, nil
+	}
+
+	if err := s.initializeTopic(ctx, topic); err != nil {
+		return StoredMessage{}, false, err
+	}
+
+	row := s.db.QueryRowContext(ctx, `SELECT "offset", uuid, payload, metadata
+		FROM `+s.schema.MessagesTable(topic)+` WHERE "offset" = $1`, offset)
+
+	msg, err := scanStoredMessage(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return StoredMessage{}, false, nil
+	}
+	if err != nil {
+		return StoredMessage{}, false, fmt.Errorf("scanning row: %w", err)
+	}
+
+	return msg, true, nil
+}
+
+func (s *SQL) DeleteMessage(ctx context.Context, topic, id string) (bool, error) {
+	offset, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return false, nil
+	}
+
+	if err := s.initializeTopic(ctx, topic); err != nil {
+		return false, err
+	}
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM `+s.schema.MessagesTable(topic)+` WHERE "offset" = $1`, offset)
+	if err != nil {
+		return false, fmt.Errorf("deleting message %s from topic %s: %w", id, topic, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("getting rows affected: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+func (s *SQL) initializeTopic(ctx context.Context, topic string) error {
+	for _, query := range s.schema.SchemaInitializingQueries(topic) {
+		if _, err := s.db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("initializing topic %s: %w", topic, err)
+		}
+	}
+
+	return nil
+}
+
+func scanStoredMessage(row interface{ Scan(...any) error }) (StoredMessage, error) {
+	var (
+		offset   int64
+		uuid     string
+		payload  []byte
+		metadata []byte
+	)
+	if err := row.Scan(&offset, &uuid, &payload, &metadata); err != nil {
+		return StoredMessage{}, err
+	}
+
+	msg := message.NewMessage(uuid, payload)
+	if metadata != nil {
+		if err := json.Unmarshal(metadata, &msg.Metadata); err != nil {
+			return StoredMessage{}, fmt.Errorf("unmarshaling metadata of message %d: %w", offset, err)
+		}
+	}
+
+	return StoredMessage{ID: strconv.FormatInt(offset, 10), Message: msg}, nil
+}
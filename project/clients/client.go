@@ -5,8 +5,14 @@ import (
 	"fmt"
 	"net/http"
 
+	"tickets/tracing"
+
 	"github.com/ThreeDotsLabs/go-event-driven/common/clients"
 	"github.com/ThreeDotsLabs/go-event-driven/common/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Clients struct {
@@ -14,13 +20,50 @@ type Clients struct {
 }
 
 func New(gatewayAddress string) (*Clients, error) {
-	c, err := clients.NewClients(gatewayAddress, func(ctx context.Context, req *http.Request) error {
-		req.Header.Set("Correlation-ID", log.CorrelationIDFromContext(ctx))
-		return nil
-	})
+	doer := tracingDoer{doer: metricsDoer{doer: http.DefaultClient}}
+
+	c, err := clients.NewClientsWithHttpClient(gatewayAddress, setCorrelationID, doer)
 	if err != nil {
 		return nil, fmt.Errorf("creating gateway client: %w", err)
 	}
 
 	return &Clients{c}, nil
 }
+
+func setCorrelationID(ctx context.Context, req *http.Request) error {
+	req.Header.Set("Correlation-ID", log.CorrelationIDFromContext(ctx))
+	return nil
+}
+
+// tracingDoer records a client span for every gateway request and propagates
+// the trace context in the request headers.
+type tracingDoer struct {
+	doer clients.HttpDoer
+}
+
+func (d tracingDoer) Do(req *http.Request) (*http.Response, error) {
+	ctx, span := tracing.Tracer().Start(req.Context(), fmt.Sprintf("%s %s", req.Method, req.URL.Path),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(req.URL.String()),
+		),
+	)
+	defer span.End()
+
+	req = req.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	res, err := d.doer.Do(req)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode))
+	if res.StatusCode >= http.StatusInternalServerError {
+		tracing.RecordError(span, fmt.Errorf("unexpected status code: %d", res.StatusCode))
+	}
+
+	return res, nil
+}
@@ -10,6 +10,23 @@ import (
 	"github.com/google/uuid"
 )
 
+type deadNationRejectedError struct {
+	statusCode int
+	body       string
+}
+
+func (e deadNationRejectedError) Error() string {
+	return fmt.Sprintf("booking rejected by dead nation: status code %d: %s", e.statusCode, e.body)
+}
+
+// Permanent reports that retrying the request will not change the outcome.
+func (e deadNationRejectedError) Permanent() bool {
+	return true
+}
+
+// DeadNationClient books tickets in Dead Nation. It has no way to cancel
+// bookings, as the Dead Nation API only takes new ones: canceled bookings are
+// added to the "dead-nation-bookings-to-cancel" tracker instead.
 type DeadNationClient struct {
 	client dead_nation.ClientWithResponsesInterface
 }
@@ -42,9 +59,22 @@ func (c DeadNationClient) CreateBooking(ctx context.Context, deadNationID string
 		return fmt.Errorf("sending create ticking booking request: %w", err)
 	}
 
-	if res.StatusCode() == http.StatusCreated {
+	if isPermanentFailure(res.StatusCode()) {
+		return deadNationRejectedError{
+			statusCode: res.StatusCode(),
+			body:       string(res.Body),
+		}
+	}
+
+	if res.StatusCode() != http.StatusOK {
 		return fmt.Errorf("unexpected status code: %d", res.StatusCode())
 	}
 
 	return nil
 }
+
+func isPermanentFailure(statusCode int) bool {
+	return statusCode >= 400 && statusCode < 500 &&
+		statusCode != http.StatusRequestTimeout &&
+		statusCode != http.StatusTooManyRequests
+}
@@ -0,0 +1,47 @@
+package clients
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/go-event-driven/common/clients"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var gatewayRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "tickets",
+	Name:      "gateway_request_duration_seconds",
+	Help:      "Gateway request latency, by client and status code.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"client", "status"})
+
+type metricsDoer struct {
+	doer clients.HttpDoer
+}
+
+func (d metricsDoer) Do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	res, err := d.doer.Do(req)
+
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(res.StatusCode)
+	}
+
+	gatewayRequestDuration.
+		WithLabelValues(clientName(req), status).
+		Observe(time.Since(start).Seconds())
+
+	return res, err
+}
+
+// clientName returns the gateway service name, which is the first path segment,
+// e.g. "payments-api".
+func clientName(req *http.Request) string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+	return name
+}
@@ -5,20 +5,50 @@ import (
 	"fmt"
 	"net/http"
 
+	"tickets/entity"
+
 	"github.com/ThreeDotsLabs/go-event-driven/common/clients/payments"
 )
 
+type refundRejectedError struct {
+	statusCode int
+	body       string
+}
+
+func (e refundRejectedError) Error() string {
+	return fmt.Sprintf("refund rejected: status code %d: %s", e.statusCode, e.body)
+}
+
+// Permanent reports that retrying the request will not change the outcome.
+func (e refundRejectedError) Permanent() bool {
+	return true
+}
+
 type PaymentsClient struct {
-	client payments.ClientWithResponsesInterface
+	client       payments.ClientWithResponsesInterface
+	spreadsheets SpreadsheetsClient
 }
 
 func NewPaymentsClient(c *Clients) PaymentsClient {
 	return PaymentsClient{
-		client: c.Payments,
+		client:       c.Payments,
+		spreadsheets: NewSpreadsheetsClient(c),
 	}
 }
 
-func (c PaymentsClient) RefundPayment(ctx context.Context, idempotencyKey string, ticketID string) error {
+// RefundPayment refunds the ticket's payment, or only amount of it if set.
+// The Payments API can only refund whole payments, so partial refunds are
+// added to the tracker of refunds to make by hand instead.
+func (c PaymentsClient) RefundPayment(ctx context.Context, idempotencyKey string, ticketID string, amount *entity.Money) error {
+	if amount != nil {
+		row := []string{ticketID, amount.Amount, amount.Currency, idempotencyKey}
+		if err := c.spreadsheets.AppendRow(ctx, "partial-refunds", row); err != nil {
+			return fmt.Errorf("failed to append row to tracker: %w", err)
+		}
+
+		return nil
+	}
+
 	res, err := c.client.PutRefundsWithResponse(ctx, payments.PaymentRefundRequest{
 		PaymentReference: ticketID,
 		Reason:           "customer requested refund",
@@ -28,6 +58,13 @@ func (c PaymentsClient) RefundPayment(ctx context.Context, idempotencyKey string
 		return fmt.Errorf("put refund request: %w", err)
 	}
 
+	if isPermanentFailure(res.StatusCode()) {
+		return refundRejectedError{
+			statusCode: res.StatusCode(),
+			body:       string(res.Body),
+		}
+	}
+
 	if res.StatusCode() != http.StatusOK {
 		return fmt.Errorf("unexpected status code: %d", res.StatusCode())
 	}
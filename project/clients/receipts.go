@@ -10,6 +10,20 @@ import (
 	"github.com/ThreeDotsLabs/go-event-driven/common/clients/receipts"
 )
 
+type voidRejectedError struct {
+	statusCode int
+	body       string
+}
+
+func (e voidRejectedError) Error() string {
+	return fmt.Sprintf("receipt void rejected: status code %d: %s", e.statusCode, e.body)
+}
+
+// Permanent reports that retrying the request will not change the outcome.
+func (e voidRejectedError) Permanent() bool {
+	return true
+}
+
 type ReceiptsClient struct {
 	client receipts.ClientWithResponsesInterface
 }
@@ -52,6 +66,13 @@ func (c ReceiptsClient) VoidReceipt(ctx context.Context, idempotencyKey, ticketI
 		return fmt.Errorf("put void receipt request: %w", err)
 	}
 
+	if isPermanentFailure(res.StatusCode()) {
+		return voidRejectedError{
+			statusCode: res.StatusCode(),
+			body:       string(res.Body),
+		}
+	}
+
 	if res.StatusCode() != http.StatusOK {
 		return fmt.Errorf("unexpected status code: %d", res.StatusCode())
 	}
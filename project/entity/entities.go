@@ -5,12 +5,66 @@ import "time"
 const (
 	StatusConfirmed = "confirmed"
 	StatusCanceled  = "canceled"
+	StatusRefunded  = "refunded"
+	StatusPrinted   = "printed"
+)
+
+const (
+	BookingSagaPending   = "pending"
+	BookingSagaConfirmed = "confirmed"
+	BookingSagaFailed    = "failed"
+)
+
+const (
+	SeatHoldActive    = "active"
+	SeatHoldConfirmed = "confirmed"
+	SeatHoldExpired   = "expired"
+)
+
+const (
+	RefundRequested       = "requested"
+	RefundPaymentRefunded = "payment_refunded"
+	RefundReceiptVoided   = "receipt_voided"
+	RefundFailed          = "failed"
+)
+
+const (
+	DiscountPercentage = "percentage"
+	DiscountFixed      = "fixed"
+)
+
+const (
+	WaitlistWaiting = "waiting"
+	WaitlistOffered = "offered"
+	WaitlistClaimed = "claimed"
+	WaitlistExpired = "expired"
 )
 
 type Ticket struct {
 	ID            string `json:"ticket_id"`
+	BookingID     string `json:"booking_id,omitempty"`
 	CustomerEmail string `json:"customer_email"`
 	Price         Money  `json:"price"`
+	Status        string `json:"status"`
+}
+
+type Refund struct {
+	RefundID       string `json:"refund_id"`
+	TicketID       string `json:"ticket_id"`
+	IdempotencyKey string `json:"-"`
+	Status         string `json:"status"`
+	// Amount is the part of the ticket's price refunded. Nil refunds the
+	// whole price.
+	Amount        *Money    `json:"amount,omitempty"`
+	FailureReason string    `json:"failure_reason,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type TicketStatusChange struct {
+	Status        string    `json:"status"`
+	CorrelationID string    `json:"correlation_id"`
+	ChangedAt     time.Time `json:"changed_at"`
 }
 
 type Money struct {
@@ -25,6 +79,35 @@ type Show struct {
 	StartTime       time.Time
 	Title           string
 	Venue           string
+	NonRefundable   bool
+	// Categories split NumberOfTickets into separately priced tickets.
+	// Shows created without categories sell unpriced tickets.
+	Categories []TicketCategory
+}
+
+type TicketCategory struct {
+	Name     string
+	Capacity uint
+	Price    Money
+}
+
+type ShowAvailability struct {
+	Show
+	TicketsAvailable    uint
+	CategoriesAvailable []TicketCategoryAvailability
+}
+
+type TicketCategoryAvailability struct {
+	TicketCategory
+	TicketsAvailable uint
+}
+
+type ShowFilter struct {
+	From   *time.Time
+	To     *time.Time
+	Venue  string
+	Limit  uint
+	Offset uint
 }
 
 type Booking struct {
@@ -32,4 +115,109 @@ type Booking struct {
 	CustomerEmail   string
 	NumberOfTickets uint
 	ShowID          string
+	// Items break the booking down by ticket category; they are empty for
+	// shows without categories. UnitPrice and TotalPrice are set from the
+	// show's prices when the booking is stored.
+	Items      []BookingItem
+	TotalPrice *Money
+	// PromoCode is redeemed when the booking is stored. Discount is taken off
+	// TotalPrice, which is the price after the discount.
+	PromoCode string
+	Discount  *Money
+}
+
+type BookingItem struct {
+	Category  string
+	Quantity  uint
+	UnitPrice Money
+}
+
+type BookingSaga struct {
+	BookingID     string    `json:"booking_id"`
+	ShowID        string    `json:"show_id"`
+	Status        string    `json:"status"`
+	FailureReason string    `json:"failure_reason,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// SeatHold reserves seats for a customer until ExpiresAt, counting against the
+// show's availability like a booking until it is confirmed or expires.
+type SeatHold struct {
+	HoldID          string    `json:"hold_id"`
+	ShowID          string    `json:"show_id"`
+	NumberOfTickets uint      `json:"number_of_tickets"`
+	CustomerEmail   string    `json:"customer_email"`
+	Status          string    `json:"status"`
+	BookingID       string    `json:"booking_id,omitempty"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// WaitlistEntry queues a customer for seats of a sold-out show. When seats are
+// offered, they are held for the customer under HoldID until ClaimExpiresAt.
+type WaitlistEntry struct {
+	EntryID         string     `json:"entry_id"`
+	ShowID          string     `json:"show_id"`
+	CustomerEmail   string     `json:"customer_email"`
+	NumberOfTickets uint       `json:"number_of_tickets"`
+	Status          string     `json:"status"`
+	HoldID          string     `json:"hold_id,omitempty"`
+	ClaimExpiresAt  *time.Time `json:"claim_expires_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+type DeadLetter struct {
+	ID          string            `json:"id"`
+	MessageUUID string            `json:"message_uuid"`
+	Handler     string            `json:"handler"`
+	Topic       string            `json:"topic"`
+	Error       string            `json:"error"`
+	Payload     string            `json:"payload"`
+	Metadata    map[string]string `json:"metadata"`
+}
+
+type PromoCode struct {
+	Code string `json:"code"`
+	// DiscountType is DiscountPercentage or DiscountFixed. A fixed discount is
+	// in Currency and never exceeds the booking's price.
+	DiscountType   string     `json:"discount_type"`
+	DiscountValue  string     `json:"discount_value"`
+	Currency       string     `json:"currency,omitempty"`
+	ShowID         string     `json:"show_id,omitempty"`
+	MaxRedemptions *uint      `json:"max_redemptions,omitempty"`
+	Redemptions    uint       `json:"redemptions"`
+	ValidFrom      *time.Time `json:"valid_from,omitempty"`
+	ValidUntil     *time.Time `json:"valid_until,omitempty"`
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type BlocklistEntry struct {
+	EntryID       string     `json:"entry_id"`
+	MessageUUID   string     `json:"message_uuid,omitempty"`
+	EventName     string     `json:"event_name,omitempty"`
+	HandlerName   string     `json:"handler_name,omitempty"`
+	Reason        string     `json:"reason"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SkippedCount  int        `json:"skipped_count"`
+	LastSkippedAt *time.Time `json:"last_skipped_at,omitempty"`
+}
+
+type StoredEvent struct {
+	Sequence      int64
+	EventID       string
+	EventName     string
+	Payload       []byte
+	Metadata      map[string]string
+	CorrelationID string
+	PublishedAt   time.Time
+	StoredAt      time.Time
+}
+
+type StoredEventFilter struct {
+	EventName string
+	From      *time.Time
+	To        *time.Time
 }
@@ -0,0 +1,113 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"tickets/entity"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type BlocklistRepo interface {
+	Add(ctx context.Context, entry entity.BlocklistEntry) error
+	Delete(ctx context.Context, entryID string) error
+	List(ctx context.Context) ([]entity.BlocklistEntry, error)
+}
+
+type createBlocklistEntryRequest struct {
+	MessageUUID string     `json:"message_uuid"`
+	EventName   string     `json:"event_name"`
+	HandlerName string     `json:"handler_name"`
+	Reason      string     `json:"reason"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+type createBlocklistEntryResponse struct {
+	EntryID string `json:"entry_id"`
+}
+
+func (h handler) ListBlocklistEntries(c echo.Context) error {
+	entries, err := h.blocklistRepo.List(c.Request().Context())
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("listing blocklist entries: %w", err),
+		}
+	}
+
+	return c.JSON(http.StatusOK, entries)
+}
+
+func (h handler) CreateBlocklistEntry(c echo.Context) error {
+	var reqBody createBlocklistEntryRequest
+	if err := c.Bind(&reqBody); err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusBadRequest,
+			Message:  "failed to parse request",
+			Internal: fmt.Errorf("failed to bind request: %w", err),
+		}
+	}
+
+	if reqBody.MessageUUID == "" && reqBody.EventName == "" && reqBody.HandlerName == "" {
+		return &echo.HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "one of message_uuid, event_name or handler_name is required",
+		}
+	}
+
+	if reqBody.Reason == "" {
+		return &echo.HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "reason is required",
+		}
+	}
+
+	entry := entity.BlocklistEntry{
+		EntryID:     uuid.NewString(),
+		MessageUUID: reqBody.MessageUUID,
+		EventName:   reqBody.EventName,
+		HandlerName: reqBody.HandlerName,
+		Reason:      reqBody.Reason,
+		ExpiresAt:   reqBody.ExpiresAt,
+	}
+
+	if err := h.blocklistRepo.Add(c.Request().Context(), entry); err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("adding blocklist entry: %w", err),
+		}
+	}
+
+	return c.JSON(http.StatusCreated, createBlocklistEntryResponse{
+		EntryID: entry.EntryID,
+	})
+}
+
+func (h handler) DeleteBlocklistEntry(c echo.Context) error {
+	err := h.blocklistRepo.Delete(c.Request().Context(), c.Param("entry_id"))
+	var notFoundErr notFoundError
+	if errors.As(err, &notFoundErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusNotFound,
+			Message:  "Blocklist entry not found",
+			Internal: fmt.Errorf("deleting blocklist entry: %w", err),
+		}
+	}
+
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("deleting blocklist entry: %w", err),
+		}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"tickets/entity"
+
+	"github.com/labstack/echo/v4"
+)
+
+type DeadLetterQueue interface {
+	List(ctx context.Context) ([]entity.DeadLetter, error)
+	Get(ctx context.Context, id string) (entity.DeadLetter, error)
+	Replay(ctx context.Context, id string) error
+	Discard(ctx context.Context, id string) error
+}
+
+func (h handler) ListDeadLetters(c echo.Context) error {
+	deadLetters, err := h.deadLetterQueue.List(c.Request().Context())
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("listing dead letters: %w", err),
+		}
+	}
+
+	return c.JSON(http.StatusOK, deadLetters)
+}
+
+func (h handler) GetDeadLetter(c echo.Context) error {
+	deadLetter, err := h.deadLetterQueue.Get(c.Request().Context(), c.Param("dead_letter_id"))
+	if err != nil {
+		return deadLetterError("getting dead letter", err)
+	}
+
+	return c.JSON(http.StatusOK, deadLetter)
+}
+
+func (h handler) ReplayDeadLetter(c echo.Context) error {
+	if err := h.deadLetterQueue.Replay(c.Request().Context(), c.Param("dead_letter_id")); err != nil {
+		return deadLetterError("replaying dead letter", err)
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+func (h handler) DiscardDeadLetter(c echo.Context) error {
+	if err := h.deadLetterQueue.Discard(c.Request().Context(), c.Param("dead_letter_id")); err != nil {
+		return deadLetterError("discarding dead letter", err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func deadLetterError(action string, err error) error {
+	var notFoundErr notFoundError
+	if errors.As(err, &notFoundErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusNotFound,
+			Message:  "Dead letter not found",
+			Internal: fmt.Errorf("%s: %w", action, err),
+		}
+	}
+
+	return &echo.HTTPError{
+		Code:     http.StatusInternalServerError,
+		Message:  http.StatusText(http.StatusInternalServerError),
+		Internal: fmt.Errorf("%s: %w", action, err),
+	}
+}
@@ -5,10 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"tickets/entity"
-	"tickets/message/command"
 	"tickets/message/event"
 
 	"github.com/ThreeDotsLabs/watermill"
@@ -17,7 +17,11 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-const headerKeyIdempotencyKey = "Idempotency-Key"
+const (
+	headerKeyIdempotencyKey = "Idempotency-Key"
+	defaultPageLimit        = 20
+	maxPageLimit            = 100
+)
 
 type createTicketsStatusRequest struct {
 	Tickets []ticketStatus `json:"tickets"`
@@ -25,6 +29,7 @@ type createTicketsStatusRequest struct {
 
 type ticketStatus struct {
 	ID            string `json:"ticket_id"`
+	BookingID     string `json:"booking_id"`
 	Status        string `json:"status"`
 	CustomerEmail string `json:"customer_email"`
 	Price         money  `json:"price"`
@@ -36,21 +41,54 @@ type money struct {
 }
 
 type createShowRequest struct {
-	DeadNationID    string    `json:"dead_nation_id"`
-	NumberOfTickets uint      `json:"number_of_tickets"`
-	StartTime       time.Time `json:"start_time"`
-	Title           string    `json:"title"`
-	Venue           string    `json:"venue"`
+	DeadNationID     string           `json:"dead_nation_id"`
+	NumberOfTickets  uint             `json:"number_of_tickets"`
+	StartTime        time.Time        `json:"start_time"`
+	Title            string           `json:"title"`
+	Venue            string           `json:"venue"`
+	NonRefundable    bool             `json:"non_refundable"`
+	TicketCategories []ticketCategory `json:"ticket_categories"`
+}
+
+type ticketCategory struct {
+	Name     string `json:"name"`
+	Capacity uint   `json:"capacity"`
+	Price    money  `json:"price"`
 }
 
 type createShowResponse struct {
 	ShowID string `json:"show_id"`
 }
 
+type showResponse struct {
+	ShowID           string                   `json:"show_id"`
+	Title            string                   `json:"title"`
+	Venue            string                   `json:"venue"`
+	StartTime        time.Time                `json:"start_time"`
+	NumberOfTickets  uint                     `json:"number_of_tickets"`
+	TicketsAvailable uint                     `json:"tickets_available"`
+	NonRefundable    bool                     `json:"non_refundable"`
+	TicketCategories []ticketCategoryResponse `json:"ticket_categories,omitempty"`
+}
+
+type ticketCategoryResponse struct {
+	Name             string `json:"name"`
+	Capacity         uint   `json:"capacity"`
+	Price            money  `json:"price"`
+	TicketsAvailable uint   `json:"tickets_available"`
+}
+
 type createBookingRequest struct {
-	ShowID          string `json:"show_id"`
-	NumberOfTickets uint   `json:"number_of_tickets"`
-	CustomerEmail   string `json:"customer_email"`
+	ShowID          string          `json:"show_id"`
+	NumberOfTickets uint            `json:"number_of_tickets"`
+	CustomerEmail   string          `json:"customer_email"`
+	Tickets         []bookedTickets `json:"tickets"`
+	PromoCode       string          `json:"promo_code"`
+}
+
+type bookedTickets struct {
+	Category string `json:"category"`
+	Quantity uint   `json:"quantity"`
 }
 
 type createBookingResponse struct {
@@ -58,24 +96,30 @@ type createBookingResponse struct {
 }
 
 type BookingRepo interface {
-	Add(ctx context.Context, ticketsAvailable uint, booking entity.Booking) error
+	Add(ctx context.Context, booking entity.Booking) error
+	Get(ctx context.Context, bookingID string) (entity.Booking, error)
+	Cancel(ctx context.Context, bookingID string) error
 }
 
-type CommandSender interface {
-	Send(ctx context.Context, cmd any) error
+type BookingSagaRepo interface {
+	Get(ctx context.Context, bookingID string) (entity.BookingSaga, error)
 }
 
 type EventPublisher interface {
-	Publish(ctx context.Context, event any) error
+	PublishAll(ctx context.Context, events []any) error
 }
 
 type ShowRepo interface {
 	Add(ctx context.Context, show entity.Show) error
 	Get(ctx context.Context, showID string) (entity.Show, error)
+	GetAvailability(ctx context.Context, showID string) (entity.ShowAvailability, error)
+	List(ctx context.Context, filter entity.ShowFilter) ([]entity.ShowAvailability, error)
 }
 
 type TicketRepo interface {
+	Get(ctx context.Context, ticketID string) (entity.Ticket, error)
 	List(ctx context.Context) ([]entity.Ticket, error)
+	History(ctx context.Context, ticketID string) ([]entity.TicketStatusChange, error)
 }
 
 type notEnoughTicketsError interface {
@@ -83,14 +127,37 @@ type notEnoughTicketsError interface {
 	NotEnoughTickets() bool
 }
 
+type invalidCategoryError interface {
+	error
+	InvalidCategory() bool
+}
+
+type alreadyCanceledError interface {
+	error
+	AlreadyCanceled() bool
+}
+
+type notFoundError interface {
+	error
+	NotFound() bool
+}
+
 type handler struct {
-	bookingRepo    BookingRepo
-	commandSender  CommandSender
-	db             *sqlx.DB
-	eventPublisher EventPublisher
-	logger         watermill.LoggerAdapter
-	showRepo       ShowRepo
-	ticketRepo     TicketRepo
+	blocklistRepo   BlocklistRepo
+	bookingRepo     BookingRepo
+	bookingSagaRepo BookingSagaRepo
+	db              *sqlx.DB
+	deadLetterQueue DeadLetterQueue
+	eventPublisher  EventPublisher
+	logger          watermill.LoggerAdapter
+	promoCodeRepo   PromoCodeRepo
+	refundPolicy    RefundPolicy
+	refundRepo      RefundRepo
+	seatHoldRepo    SeatHoldRepo
+	seatHoldTTL     time.Duration
+	showRepo        ShowRepo
+	ticketRepo      TicketRepo
+	waitlistRepo    WaitlistRepo
 }
 
 func (h handler) CreateTicketStatus(c echo.Context) error {
@@ -108,9 +175,11 @@ func (h handler) CreateTicketStatus(c echo.Context) error {
 		return err
 	}
 
+	events := make([]any, 0, len(body.Tickets))
 	for _, ticketStatus := range body.Tickets {
 		ticket := entity.Ticket{
 			ID:            ticketStatus.ID,
+			BookingID:     ticketStatus.BookingID,
 			CustomerEmail: ticketStatus.CustomerEmail,
 			Price: entity.Money{
 				Amount:   ticketStatus.Price.Amount,
@@ -120,23 +189,29 @@ func (h handler) CreateTicketStatus(c echo.Context) error {
 
 		ticketIdempotencyKey := idempotencyKey + ticketStatus.ID
 
-		var e any
 		switch ticketStatus.Status {
 		case entity.StatusConfirmed:
-			e = event.NewTicketBookingConfirmed(ticketIdempotencyKey, ticket)
+			events = append(events, event.NewTicketBookingConfirmed(ticketIdempotencyKey, ticket))
 		case entity.StatusCanceled:
-			e = event.NewTicketBookingCanceled(ticketIdempotencyKey, ticket)
-		}
-
-		if err := h.eventPublisher.Publish(c.Request().Context(), e); err != nil {
+			events = append(events, event.NewTicketBookingCanceled(ticketIdempotencyKey, ticket))
+		default:
 			return &echo.HTTPError{
-				Code:     http.StatusInternalServerError,
-				Message:  http.StatusText(http.StatusInternalServerError),
-				Internal: fmt.Errorf("publishing event to old topic: %w", err),
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("ticket %s: unknown status %q", ticketStatus.ID, ticketStatus.Status),
 			}
 		}
 	}
 
+	// The whole batch goes through the outbox in one transaction, so a failure
+	// doesn't leave part of it published.
+	if err := h.eventPublisher.PublishAll(c.Request().Context(), events); err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("publishing ticket events: %w", err),
+		}
+	}
+
 	return c.NoContent(http.StatusOK)
 }
 
@@ -153,6 +228,28 @@ func (h handler) ListTickets(c echo.Context) error {
 	return c.JSON(http.StatusOK, tickets)
 }
 
+func (h handler) GetTicketHistory(c echo.Context) error {
+	history, err := h.ticketRepo.History(c.Request().Context(), c.Param("ticket_id"))
+	var notFoundErr notFoundError
+	if errors.As(err, &notFoundErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusNotFound,
+			Message:  "Ticket not found",
+			Internal: fmt.Errorf("getting ticket history: %w", err),
+		}
+	}
+
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("getting ticket history: %w", err),
+		}
+	}
+
+	return c.JSON(http.StatusOK, history)
+}
+
 func (h handler) CreateShow(c echo.Context) error {
 	var reqBody createShowRequest
 	if err := c.Bind(&reqBody); err != nil {
@@ -163,6 +260,15 @@ func (h handler) CreateShow(c echo.Context) error {
 		}
 	}
 
+	categories, err := parseTicketCategories(reqBody.TicketCategories)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusBadRequest,
+			Message:  err.Error(),
+			Internal: fmt.Errorf("parsing ticket categories: %w", err),
+		}
+	}
+
 	show := entity.Show{
 		ShowID:          uuid.NewString(),
 		DeadNationID:    reqBody.DeadNationID,
@@ -170,6 +276,23 @@ func (h handler) CreateShow(c echo.Context) error {
 		StartTime:       reqBody.StartTime.UTC(),
 		Title:           reqBody.Title,
 		Venue:           reqBody.Venue,
+		NonRefundable:   reqBody.NonRefundable,
+		Categories:      categories,
+	}
+
+	if len(categories) > 0 {
+		var capacity uint
+		for _, category := range categories {
+			capacity += category.Capacity
+		}
+
+		if show.NumberOfTickets != 0 && show.NumberOfTickets != capacity {
+			return &echo.HTTPError{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("number_of_tickets must equal the total capacity of ticket_categories (%d)", capacity),
+			}
+		}
+		show.NumberOfTickets = capacity
 	}
 
 	if err := h.showRepo.Add(c.Request().Context(), show); err != nil {
@@ -185,6 +308,55 @@ func (h handler) CreateShow(c echo.Context) error {
 	})
 }
 
+func (h handler) ListShows(c echo.Context) error {
+	filter, err := parseShowFilter(c)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusBadRequest,
+			Message:  err.Error(),
+			Internal: fmt.Errorf("parsing show filter: %w", err),
+		}
+	}
+
+	shows, err := h.showRepo.List(c.Request().Context(), filter)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("listing shows: %w", err),
+		}
+	}
+
+	resBody := make([]showResponse, 0, len(shows))
+	for _, show := range shows {
+		resBody = append(resBody, newShowResponse(show))
+	}
+
+	return c.JSON(http.StatusOK, resBody)
+}
+
+func (h handler) GetShow(c echo.Context) error {
+	show, err := h.showRepo.GetAvailability(c.Request().Context(), c.Param("show_id"))
+	var notFoundErr notFoundError
+	if errors.As(err, &notFoundErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusNotFound,
+			Message:  "Show not found",
+			Internal: fmt.Errorf("getting show: %w", err),
+		}
+	}
+
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("getting show: %w", err),
+		}
+	}
+
+	return c.JSON(http.StatusOK, newShowResponse(show))
+}
+
 func (h handler) CreateBooking(c echo.Context) error {
 	var reqBody createBookingRequest
 	if err := c.Bind(&reqBody); err != nil {
@@ -196,6 +368,15 @@ func (h handler) CreateBooking(c echo.Context) error {
 	}
 
 	show, err := h.showRepo.Get(c.Request().Context(), reqBody.ShowID)
+	var notFoundErr notFoundError
+	if errors.As(err, &notFoundErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusNotFound,
+			Message:  "Show not found",
+			Internal: fmt.Errorf("getting show: %w", err),
+		}
+	}
+
 	if err != nil {
 		return fmt.Errorf("getting show: %w", err)
 	}
@@ -205,9 +386,23 @@ func (h handler) CreateBooking(c echo.Context) error {
 		CustomerEmail:   reqBody.CustomerEmail,
 		NumberOfTickets: reqBody.NumberOfTickets,
 		ShowID:          reqBody.ShowID,
+		PromoCode:       reqBody.PromoCode,
+	}
+
+	if len(show.Categories) > 0 || len(reqBody.Tickets) > 0 {
+		items, numberOfTickets, err := parseBookedTickets(reqBody.Tickets, reqBody.NumberOfTickets)
+		if err != nil {
+			return &echo.HTTPError{
+				Code:     http.StatusBadRequest,
+				Message:  err.Error(),
+				Internal: fmt.Errorf("parsing booked tickets: %w", err),
+			}
+		}
+		booking.Items = items
+		booking.NumberOfTickets = numberOfTickets
 	}
 
-	err = h.bookingRepo.Add(c.Request().Context(), show.NumberOfTickets, booking)
+	err = h.bookingRepo.Add(c.Request().Context(), booking)
 	var notEnoughTicketsErr notEnoughTicketsError
 	if errors.As(err, &notEnoughTicketsErr) {
 		return &echo.HTTPError{
@@ -217,6 +412,24 @@ func (h handler) CreateBooking(c echo.Context) error {
 		}
 	}
 
+	var invalidCategoryErr invalidCategoryError
+	if errors.As(err, &invalidCategoryErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusBadRequest,
+			Message:  "Unknown ticket category",
+			Internal: fmt.Errorf("adding booking: %w", err),
+		}
+	}
+
+	var invalidPromoCodeErr invalidPromoCodeError
+	if errors.As(err, &invalidPromoCodeErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusBadRequest,
+			Message:  invalidPromoCodeErr.Error(),
+			Internal: fmt.Errorf("adding booking: %w", err),
+		}
+	}
+
 	if err != nil {
 		return &echo.HTTPError{
 			Code:     http.StatusInternalServerError,
@@ -230,19 +443,102 @@ func (h handler) CreateBooking(c echo.Context) error {
 	})
 }
 
+func (h handler) CancelBooking(c echo.Context) error {
+	err := h.bookingRepo.Cancel(c.Request().Context(), c.Param("booking_id"))
+	var notFoundErr notFoundError
+	if errors.As(err, &notFoundErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusNotFound,
+			Message:  "Booking not found",
+			Internal: fmt.Errorf("canceling booking: %w", err),
+		}
+	}
+
+	var alreadyCanceledErr alreadyCanceledError
+	if errors.As(err, &alreadyCanceledErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusConflict,
+			Message:  "Booking already canceled",
+			Internal: fmt.Errorf("canceling booking: %w", err),
+		}
+	}
+
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("canceling booking: %w", err),
+		}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h handler) GetBookingSaga(c echo.Context) error {
+	saga, err := h.bookingSagaRepo.Get(c.Request().Context(), c.Param("booking_id"))
+	var notFoundErr notFoundError
+	if errors.As(err, &notFoundErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusNotFound,
+			Message:  "Booking not found",
+			Internal: fmt.Errorf("getting booking saga: %w", err),
+		}
+	}
+
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("getting booking saga: %w", err),
+		}
+	}
+
+	return c.JSON(http.StatusOK, saga)
+}
+
 func (h handler) RefundTicket(c echo.Context) error {
 	idempotencyKey := getOrGenerateIdempotencyKey(c)
-	cmd := command.NewRefundTicket(c.Param("ticket_id"), idempotencyKey)
+	ticketID := c.Param("ticket_id")
+
+	refund, err := h.requestedRefund(c.Request().Context(), ticketID, idempotencyKey)
+	var rejectedErr refundRejectedError
+	if errors.As(err, &rejectedErr) {
+		rule, reason := rejectedErr.RefundRejected()
+		return c.JSON(http.StatusUnprocessableEntity, refundRejectedResponse{
+			Error: reason,
+			Rule:  rule,
+		})
+	}
 
-	if err := h.commandSender.Send(c.Request().Context(), cmd); err != nil {
+	var notFoundErr notFoundError
+	if errors.As(err, &notFoundErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusNotFound,
+			Message:  "Ticket not found",
+			Internal: fmt.Errorf("applying refund policy: %w", err),
+		}
+	}
+
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("applying refund policy: %w", err),
+		}
+	}
+
+	refund, err = h.refundRepo.Add(c.Request().Context(), refund)
+	if err != nil {
 		return &echo.HTTPError{
 			Code:     http.StatusInternalServerError,
 			Message:  http.StatusText(http.StatusInternalServerError),
-			Internal: fmt.Errorf("publishing refund ticket command: %w", err),
+			Internal: fmt.Errorf("adding refund: %w", err),
 		}
 	}
 
-	return c.NoContent(http.StatusAccepted)
+	return c.JSON(http.StatusAccepted, refundTicketResponse{
+		RefundID: refund.RefundID,
+	})
 }
 
 func getIdempotencyKey(c echo.Context) (string, error) {
@@ -265,3 +561,68 @@ func getOrGenerateIdempotencyKey(c echo.Context) string {
 
 	return idempotencyKey
 }
+
+func newShowResponse(show entity.ShowAvailability) showResponse {
+	var categories []ticketCategoryResponse
+	for _, category := range show.CategoriesAvailable {
+		categories = append(categories, ticketCategoryResponse{
+			Name:     category.Name,
+			Capacity: category.Capacity,
+			Price: money{
+				Amount:   category.Price.Amount,
+				Currency: category.Price.Currency,
+			},
+			TicketsAvailable: category.TicketsAvailable,
+		})
+	}
+
+	return showResponse{
+		ShowID:           show.ShowID,
+		Title:            show.Title,
+		Venue:            show.Venue,
+		StartTime:        show.StartTime,
+		NumberOfTickets:  show.NumberOfTickets,
+		TicketsAvailable: show.TicketsAvailable,
+		NonRefundable:    show.NonRefundable,
+		TicketCategories: categories,
+	}
+}
+
+func parseShowFilter(c echo.Context) (entity.ShowFilter, error) {
+	filter := entity.ShowFilter{
+		Venue: c.QueryParam("venue"),
+		Limit: defaultPageLimit,
+	}
+
+	for param, dest := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		v := c.QueryParam(param)
+		if v == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return entity.ShowFilter{}, fmt.Errorf("invalid %s: must be an RFC 3339 timestamp", param)
+		}
+		*dest = &t
+	}
+
+	for param, dest := range map[string]*uint{"limit": &filter.Limit, "offset": &filter.Offset} {
+		v := c.QueryParam(param)
+		if v == "" {
+			continue
+		}
+
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return entity.ShowFilter{}, fmt.Errorf("invalid %s: must be a non-negative integer", param)
+		}
+		*dest = uint(n)
+	}
+
+	if filter.Limit == 0 || filter.Limit > maxPageLimit {
+		return entity.ShowFilter{}, fmt.Errorf("invalid limit: must be between 1 and %d", maxPageLimit)
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,176 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tickets/entity"
+
+	"github.com/labstack/echo/v4"
+)
+
+const maxPromoCodeLength = 64
+
+type PromoCodeRepo interface {
+	Add(ctx context.Context, promoCode entity.PromoCode) error
+	List(ctx context.Context) ([]entity.PromoCode, error)
+	Disable(ctx context.Context, code string) error
+}
+
+type alreadyExistsError interface {
+	error
+	AlreadyExists() bool
+}
+
+type invalidPromoCodeError interface {
+	error
+	InvalidPromoCode() bool
+}
+
+type createPromoCodeRequest struct {
+	Code           string     `json:"code"`
+	DiscountType   string     `json:"discount_type"`
+	DiscountValue  string     `json:"discount_value"`
+	Currency       string     `json:"currency"`
+	ShowID         string     `json:"show_id"`
+	MaxRedemptions *uint      `json:"max_redemptions"`
+	ValidFrom      *time.Time `json:"valid_from"`
+	ValidUntil     *time.Time `json:"valid_until"`
+}
+
+func (h handler) ListPromoCodes(c echo.Context) error {
+	promoCodes, err := h.promoCodeRepo.List(c.Request().Context())
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("listing promo codes: %w", err),
+		}
+	}
+
+	return c.JSON(http.StatusOK, promoCodes)
+}
+
+func (h handler) CreatePromoCode(c echo.Context) error {
+	var reqBody createPromoCodeRequest
+	if err := c.Bind(&reqBody); err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusBadRequest,
+			Message:  "failed to parse request",
+			Internal: fmt.Errorf("failed to bind request: %w", err),
+		}
+	}
+
+	if err := validatePromoCode(reqBody); err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusBadRequest,
+			Message:  err.Error(),
+			Internal: fmt.Errorf("validating promo code: %w", err),
+		}
+	}
+
+	if reqBody.ShowID != "" {
+		_, err := h.showRepo.Get(c.Request().Context(), reqBody.ShowID)
+		var notFoundErr notFoundError
+		if errors.As(err, &notFoundErr) {
+			return &echo.HTTPError{
+				Code:     http.StatusBadRequest,
+				Message:  "Show not found",
+				Internal: fmt.Errorf("getting show: %w", err),
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("getting show: %w", err)
+		}
+	}
+
+	promoCode := entity.PromoCode{
+		Code:           reqBody.Code,
+		DiscountType:   reqBody.DiscountType,
+		DiscountValue:  reqBody.DiscountValue,
+		ShowID:         reqBody.ShowID,
+		MaxRedemptions: reqBody.MaxRedemptions,
+		ValidFrom:      reqBody.ValidFrom,
+		ValidUntil:     reqBody.ValidUntil,
+	}
+	if promoCode.DiscountType == entity.DiscountFixed {
+		promoCode.Currency = reqBody.Currency
+	}
+
+	err := h.promoCodeRepo.Add(c.Request().Context(), promoCode)
+	var alreadyExistsErr alreadyExistsError
+	if errors.As(err, &alreadyExistsErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusConflict,
+			Message:  "Promo code already exists",
+			Internal: fmt.Errorf("adding promo code: %w", err),
+		}
+	}
+
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("adding promo code: %w", err),
+		}
+	}
+
+	return c.NoContent(http.StatusCreated)
+}
+
+func (h handler) DisablePromoCode(c echo.Context) error {
+	err := h.promoCodeRepo.Disable(c.Request().Context(), c.Param("code"))
+	var notFoundErr notFoundError
+	if errors.As(err, &notFoundErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusNotFound,
+			Message:  "Promo code not found",
+			Internal: fmt.Errorf("disabling promo code: %w", err),
+		}
+	}
+
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("disabling promo code: %w", err),
+		}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func validatePromoCode(req createPromoCodeRequest) error {
+	if req.Code == "" || len(req.Code) > maxPromoCodeLength {
+		return fmt.Errorf("code must be between 1 and %d characters", maxPromoCodeLength)
+	}
+
+	value, err := strconv.ParseFloat(req.DiscountValue, 64)
+	if err != nil || value <= 0 {
+		return errors.New("discount_value must be a positive amount")
+	}
+
+	switch req.DiscountType {
+	case entity.DiscountPercentage:
+		if value > 100 {
+			return errors.New("percentage discount_value must not exceed 100")
+		}
+	case entity.DiscountFixed:
+		if len(req.Currency) != 3 {
+			return errors.New("fixed discount requires a 3-letter currency")
+		}
+	default:
+		return fmt.Errorf("discount_type must be %s or %s", entity.DiscountPercentage, entity.DiscountFixed)
+	}
+
+	if req.ValidFrom != nil && req.ValidUntil != nil && !req.ValidUntil.After(*req.ValidFrom) {
+		return errors.New("valid_until must be after valid_from")
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"tickets/entity"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type RefundRepo interface {
+	Add(ctx context.Context, refund entity.Refund) (entity.Refund, error)
+	Get(ctx context.Context, refundID string) (entity.Refund, error)
+	GetByIdempotencyKey(ctx context.Context, idempotencyKey string) (entity.Refund, error)
+}
+
+type RefundPolicy interface {
+	Amount(ticket entity.Ticket, show *entity.Show, now time.Time) (entity.Money, error)
+}
+
+type refundRejectedError interface {
+	error
+	RefundRejected() (rule, reason string)
+}
+
+type refundTicketResponse struct {
+	RefundID string `json:"refund_id"`
+}
+
+type refundRejectedResponse struct {
+	Error string `json:"error"`
+	Rule  string `json:"rule"`
+}
+
+func (h handler) GetRefund(c echo.Context) error {
+	refund, err := h.refundRepo.Get(c.Request().Context(), c.Param("refund_id"))
+	var notFoundErr notFoundError
+	if errors.As(err, &notFoundErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusNotFound,
+			Message:  "Refund not found",
+			Internal: fmt.Errorf("getting refund: %w", err),
+		}
+	}
+
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("getting refund: %w", err),
+		}
+	}
+
+	return c.JSON(http.StatusOK, refund)
+}
+
+// requestedRefund returns the refund already requested with the idempotency
+// key, so a retried request gets the outcome of the first one even if the
+// policy would decide differently by now. Otherwise it applies the policy to
+// a new refund.
+func (h handler) requestedRefund(ctx context.Context, ticketID, idempotencyKey string) (entity.Refund, error) {
+	existing, err := h.refundRepo.GetByIdempotencyKey(ctx, idempotencyKey)
+	if err == nil {
+		return existing, nil
+	}
+
+	var notFoundErr notFoundError
+	if !errors.As(err, &notFoundErr) {
+		return entity.Refund{}, fmt.Errorf("getting refund: %w", err)
+	}
+
+	amount, err := h.refundAmount(ctx, ticketID)
+	if err != nil {
+		return entity.Refund{}, err
+	}
+
+	return entity.Refund{
+		RefundID:       uuid.NewString(),
+		TicketID:       ticketID,
+		IdempotencyKey: idempotencyKey,
+		Amount:         amount,
+	}, nil
+}
+
+// refundAmount applies the refund policy to the ticket. It returns nil if the
+// whole price is refunded. Tickets stored without a booking aren't linked to
+// a show, so the policy refunds them in full.
+func (h handler) refundAmount(ctx context.Context, ticketID string) (*entity.Money, error) {
+	ticket, err := h.ticketRepo.Get(ctx, ticketID)
+	if err != nil {
+		return nil, fmt.Errorf("getting ticket: %w", err)
+	}
+
+	var show *entity.Show
+	if ticket.BookingID != "" {
+		booking, err := h.bookingRepo.Get(ctx, ticket.BookingID)
+		if err != nil {
+			return nil, fmt.Errorf("getting booking: %w", err)
+		}
+
+		s, err := h.showRepo.Get(ctx, booking.ShowID)
+		if err != nil {
+			return nil, fmt.Errorf("getting show: %w", err)
+		}
+		show = &s
+	}
+
+	amount, err := h.refundPolicy.Amount(ticket, show, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if amount == ticket.Price {
+		return nil, nil
+	}
+
+	return &amount, nil
+}
@@ -2,47 +2,91 @@ package http
 
 import (
 	"net/http"
+	"time"
 
 	commonHTTP "github.com/ThreeDotsLabs/go-event-driven/common/http"
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var ErrServerClosed = http.ErrServerClosed
 
 type RouterDeps struct {
-	BookingRepo    BookingRepo
-	CommandSender  CommandSender
-	DB             *sqlx.DB
-	EventPublisher EventPublisher
-	Logger         watermill.LoggerAdapter
-	ShowRepo       ShowRepo
-	TicketRepo     TicketRepo
+	BlocklistRepo   BlocklistRepo
+	BookingRepo     BookingRepo
+	BookingSagaRepo BookingSagaRepo
+	DB              *sqlx.DB
+	DeadLetterQueue DeadLetterQueue
+	EventPublisher  EventPublisher
+	Logger          watermill.LoggerAdapter
+	PromoCodeRepo   PromoCodeRepo
+	RefundPolicy    RefundPolicy
+	RefundRepo      RefundRepo
+	SeatHoldRepo    SeatHoldRepo
+	SeatHoldTTL     time.Duration
+	ShowRepo        ShowRepo
+	TicketRepo      TicketRepo
+	WaitlistRepo    WaitlistRepo
 }
 
 func NewRouter(deps RouterDeps) *echo.Echo {
 	server := commonHTTP.NewEcho()
+	server.Use(tracingMiddleware)
+	server.Use(metricsMiddleware)
 
 	server.GET("/health", func(c echo.Context) error {
 		return c.String(http.StatusOK, "ok")
 	})
 
+	server.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+
 	handler := handler{
-		bookingRepo:    deps.BookingRepo,
-		commandSender:  deps.CommandSender,
-		db:             deps.DB,
-		eventPublisher: deps.EventPublisher,
-		logger:         deps.Logger,
-		showRepo:       deps.ShowRepo,
-		ticketRepo:     deps.TicketRepo,
+		blocklistRepo:   deps.BlocklistRepo,
+		bookingRepo:     deps.BookingRepo,
+		bookingSagaRepo: deps.BookingSagaRepo,
+		db:              deps.DB,
+		deadLetterQueue: deps.DeadLetterQueue,
+		eventPublisher:  deps.EventPublisher,
+		logger:          deps.Logger,
+		promoCodeRepo:   deps.PromoCodeRepo,
+		refundPolicy:    deps.RefundPolicy,
+		refundRepo:      deps.RefundRepo,
+		seatHoldRepo:    deps.SeatHoldRepo,
+		seatHoldTTL:     deps.SeatHoldTTL,
+		showRepo:        deps.ShowRepo,
+		ticketRepo:      deps.TicketRepo,
+		waitlistRepo:    deps.WaitlistRepo,
 	}
 
 	server.POST("/shows", handler.CreateShow)
+	server.GET("/shows", handler.ListShows)
+	server.GET("/shows/:show_id", handler.GetShow)
+	server.POST("/shows/:show_id/holds", handler.CreateSeatHold)
+	server.POST("/holds/:hold_id/confirm", handler.ConfirmSeatHold)
+	server.POST("/shows/:show_id/waitlist", handler.JoinWaitlist)
+	server.GET("/waitlist/:entry_id", handler.GetWaitlistEntry)
+	server.GET("/promo-codes", handler.ListPromoCodes)
+	server.POST("/promo-codes", handler.CreatePromoCode)
+	server.POST("/promo-codes/:code/disable", handler.DisablePromoCode)
 	server.POST("/book-tickets", handler.CreateBooking)
+	server.DELETE("/bookings/:booking_id", handler.CancelBooking)
+	server.GET("/bookings/:booking_id/saga", handler.GetBookingSaga)
 	server.POST("/tickets-status", handler.CreateTicketStatus)
 	server.GET("/tickets", handler.ListTickets)
+	server.GET("/tickets/:ticket_id/history", handler.GetTicketHistory)
 	server.PUT("/ticket-refund/:ticket_id", handler.RefundTicket)
+	server.GET("/refunds/:refund_id", handler.GetRefund)
+
+	server.GET("/dead-letters", handler.ListDeadLetters)
+	server.GET("/dead-letters/:dead_letter_id", handler.GetDeadLetter)
+	server.POST("/dead-letters/:dead_letter_id/replay", handler.ReplayDeadLetter)
+	server.DELETE("/dead-letters/:dead_letter_id", handler.DiscardDeadLetter)
+
+	server.GET("/message-blocklist", handler.ListBlocklistEntries)
+	server.POST("/message-blocklist", handler.CreateBlocklistEntry)
+	server.DELETE("/message-blocklist/:entry_id", handler.DeleteBlocklistEntry)
 
 	return server
 }
@@ -0,0 +1,139 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"tickets/entity"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type SeatHoldRepo interface {
+	Add(ctx context.Context, hold entity.SeatHold) error
+	Confirm(ctx context.Context, holdID string) (entity.Booking, error)
+}
+
+type expiredError interface {
+	error
+	Expired() bool
+}
+
+type createSeatHoldRequest struct {
+	NumberOfTickets uint   `json:"number_of_tickets"`
+	CustomerEmail   string `json:"customer_email"`
+}
+
+type createSeatHoldResponse struct {
+	HoldID    string    `json:"hold_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (h handler) CreateSeatHold(c echo.Context) error {
+	var reqBody createSeatHoldRequest
+	if err := c.Bind(&reqBody); err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusBadRequest,
+			Message:  "failed to parse request",
+			Internal: fmt.Errorf("failed to bind request: %w", err),
+		}
+	}
+
+	if reqBody.NumberOfTickets == 0 {
+		return &echo.HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "number_of_tickets must be positive",
+		}
+	}
+
+	show, err := h.showRepo.Get(c.Request().Context(), c.Param("show_id"))
+	var notFoundErr notFoundError
+	if errors.As(err, &notFoundErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusNotFound,
+			Message:  "Show not found",
+			Internal: fmt.Errorf("getting show: %w", err),
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("getting show: %w", err)
+	}
+
+	// Holds aren't tied to a ticket category, so they would let bookings
+	// exceed a category's capacity.
+	if len(show.Categories) > 0 {
+		return &echo.HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Show sells tickets per category, book them directly",
+		}
+	}
+
+	hold := entity.SeatHold{
+		HoldID:          uuid.NewString(),
+		ShowID:          show.ShowID,
+		NumberOfTickets: reqBody.NumberOfTickets,
+		CustomerEmail:   reqBody.CustomerEmail,
+		ExpiresAt:       time.Now().Add(h.seatHoldTTL).UTC(),
+	}
+
+	err = h.seatHoldRepo.Add(c.Request().Context(), hold)
+	var notEnoughTicketsErr notEnoughTicketsError
+	if errors.As(err, &notEnoughTicketsErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusBadRequest,
+			Message:  "Not enough tickets",
+			Internal: fmt.Errorf("adding seat hold: %w", err),
+		}
+	}
+
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("adding seat hold: %w", err),
+		}
+	}
+
+	return c.JSON(http.StatusCreated, createSeatHoldResponse{
+		HoldID:    hold.HoldID,
+		ExpiresAt: hold.ExpiresAt,
+	})
+}
+
+func (h handler) ConfirmSeatHold(c echo.Context) error {
+	booking, err := h.seatHoldRepo.Confirm(c.Request().Context(), c.Param("hold_id"))
+	var notFoundErr notFoundError
+	if errors.As(err, &notFoundErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusNotFound,
+			Message:  "Seat hold not found",
+			Internal: fmt.Errorf("confirming seat hold: %w", err),
+		}
+	}
+
+	var expiredErr expiredError
+	if errors.As(err, &expiredErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusGone,
+			Message:  "Seat hold expired",
+			Internal: fmt.Errorf("confirming seat hold: %w", err),
+		}
+	}
+
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("confirming seat hold: %w", err),
+		}
+	}
+
+	return c.JSON(http.StatusCreated, createBookingResponse{
+		BookingID: booking.BookingID,
+	})
+}
@@ -0,0 +1,84 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"tickets/entity"
+)
+
+func parseTicketCategories(categories []ticketCategory) ([]entity.TicketCategory, error) {
+	parsed := make([]entity.TicketCategory, 0, len(categories))
+	names := make(map[string]struct{}, len(categories))
+	for _, c := range categories {
+		if c.Name == "" {
+			return nil, errors.New("ticket category name is required")
+		}
+		if _, ok := names[c.Name]; ok {
+			return nil, fmt.Errorf("duplicate ticket category %s", c.Name)
+		}
+		names[c.Name] = struct{}{}
+
+		if c.Capacity == 0 {
+			return nil, fmt.Errorf("capacity of ticket category %s must be positive", c.Name)
+		}
+
+		amount, err := strconv.ParseFloat(c.Price.Amount, 64)
+		if err != nil || amount < 0 {
+			return nil, fmt.Errorf("price of ticket category %s must be a non-negative amount", c.Name)
+		}
+
+		if len(c.Price.Currency) != 3 {
+			return nil, fmt.Errorf("currency of ticket category %s must be a 3-letter code", c.Name)
+		}
+		if len(parsed) > 0 && parsed[0].Price.Currency != c.Price.Currency {
+			return nil, errors.New("ticket categories must share one currency")
+		}
+
+		parsed = append(parsed, entity.TicketCategory{
+			Name:     c.Name,
+			Capacity: c.Capacity,
+			Price: entity.Money{
+				Amount:   c.Price.Amount,
+				Currency: c.Price.Currency,
+			},
+		})
+	}
+
+	return parsed, nil
+}
+
+// parseBookedTickets returns booking items for the requested tickets and their
+// total quantity. numberOfTickets, if set, must match the total.
+func parseBookedTickets(tickets []bookedTickets, numberOfTickets uint) ([]entity.BookingItem, uint, error) {
+	if len(tickets) == 0 {
+		return nil, 0, errors.New("tickets must be booked per ticket category")
+	}
+
+	items := make([]entity.BookingItem, 0, len(tickets))
+	categories := make(map[string]struct{}, len(tickets))
+	var total uint
+	for _, t := range tickets {
+		if _, ok := categories[t.Category]; ok {
+			return nil, 0, fmt.Errorf("duplicate ticket category %s", t.Category)
+		}
+		categories[t.Category] = struct{}{}
+
+		if t.Quantity == 0 {
+			return nil, 0, fmt.Errorf("quantity of ticket category %s must be positive", t.Category)
+		}
+		total += t.Quantity
+
+		items = append(items, entity.BookingItem{
+			Category: t.Category,
+			Quantity: t.Quantity,
+		})
+	}
+
+	if numberOfTickets != 0 && numberOfTickets != total {
+		return nil, 0, fmt.Errorf("number_of_tickets must equal the total quantity of tickets (%d)", total)
+	}
+
+	return items, total, nil
+}
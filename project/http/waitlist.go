@@ -0,0 +1,109 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"tickets/entity"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type WaitlistRepo interface {
+	Add(ctx context.Context, entry entity.WaitlistEntry) error
+	Get(ctx context.Context, entryID string) (entity.WaitlistEntry, error)
+}
+
+type joinWaitlistRequest struct {
+	NumberOfTickets uint   `json:"number_of_tickets"`
+	CustomerEmail   string `json:"customer_email"`
+}
+
+type joinWaitlistResponse struct {
+	EntryID string `json:"entry_id"`
+}
+
+func (h handler) JoinWaitlist(c echo.Context) error {
+	var reqBody joinWaitlistRequest
+	if err := c.Bind(&reqBody); err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusBadRequest,
+			Message:  "failed to parse request",
+			Internal: fmt.Errorf("failed to bind request: %w", err),
+		}
+	}
+
+	show, err := h.showRepo.Get(c.Request().Context(), c.Param("show_id"))
+	var notFoundErr notFoundError
+	if errors.As(err, &notFoundErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusNotFound,
+			Message:  "Show not found",
+			Internal: fmt.Errorf("getting show: %w", err),
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("getting show: %w", err)
+	}
+
+	// Offers are made as seat holds, which have no ticket category.
+	if len(show.Categories) > 0 {
+		return &echo.HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Waitlist is not available for shows with ticket categories",
+		}
+	}
+
+	// Entries are served in order, so one that can never fit would block the queue.
+	if reqBody.NumberOfTickets == 0 || reqBody.NumberOfTickets > show.NumberOfTickets {
+		return &echo.HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("number_of_tickets must be between 1 and %d", show.NumberOfTickets),
+		}
+	}
+
+	entry := entity.WaitlistEntry{
+		EntryID:         uuid.NewString(),
+		ShowID:          show.ShowID,
+		CustomerEmail:   reqBody.CustomerEmail,
+		NumberOfTickets: reqBody.NumberOfTickets,
+	}
+
+	if err := h.waitlistRepo.Add(c.Request().Context(), entry); err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("adding waitlist entry: %w", err),
+		}
+	}
+
+	return c.JSON(http.StatusCreated, joinWaitlistResponse{
+		EntryID: entry.EntryID,
+	})
+}
+
+func (h handler) GetWaitlistEntry(c echo.Context) error {
+	entry, err := h.waitlistRepo.Get(c.Request().Context(), c.Param("entry_id"))
+	var notFoundErr notFoundError
+	if errors.As(err, &notFoundErr) {
+		return &echo.HTTPError{
+			Code:     http.StatusNotFound,
+			Message:  "Waitlist entry not found",
+			Internal: fmt.Errorf("getting waitlist entry: %w", err),
+		}
+	}
+
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  http.StatusText(http.StatusInternalServerError),
+			Internal: fmt.Errorf("getting waitlist entry: %w", err),
+		}
+	}
+
+	return c.JSON(http.StatusOK, entry)
+}
@@ -2,12 +2,21 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"time"
 
+	"tickets/broker"
 	"tickets/clients"
+	"tickets/entity"
+	"tickets/message"
+	"tickets/postgres"
+	"tickets/refund"
 	"tickets/service"
+	"tickets/tracing"
 
 	"github.com/ThreeDotsLabs/go-event-driven/common/log"
 	"github.com/ThreeDotsLabs/watermill"
@@ -21,38 +30,61 @@ func main() {
 	log.Init(logrus.InfoLevel)
 	logger := watermill.NewStdLogger(false, false)
 
-	if err := run(logger); err != nil {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	exporter, err := tracing.NewExporter(ctx)
+	if err != nil {
+		logger.Error("failed to create trace exporter", err, nil)
+		os.Exit(1)
+	}
+
+	tp := tracing.Init(exporter)
+	defer func() {
+		if err := tp.Shutdown(context.Background()); err != nil {
+			logger.Error("failed to shut down tracer provider", err, nil)
+		}
+	}()
+
+	var subcommand string
+	if len(os.Args) > 1 {
+		subcommand = os.Args[1]
+	}
+
+	switch subcommand {
+	case "migrate":
+		err = migrate(ctx, os.Args[2:], logger)
+	case "replay-events":
+		err = replayEvents(ctx, os.Args[2:], logger)
+	default:
+		err = run(ctx, logger)
+	}
+
+	if err != nil {
 		logger.Error("failed to run", err, nil)
+		cancel()
+		_ = tp.Shutdown(context.Background())
+		os.Exit(1)
 	}
 }
 
-func run(logger watermill.LoggerAdapter) error {
+func run(ctx context.Context, logger watermill.LoggerAdapter) error {
 	gatewayClient, err := clients.New(os.Getenv("GATEWAY_ADDR"))
 	if err != nil {
 		return fmt.Errorf("creating gateway client: %w", err)
 	}
 
-	redisClient := redis.NewClient(&redis.Options{
-		Addr: os.Getenv("REDIS_ADDR"),
-	})
-	defer func() {
-		if err := redisClient.Conn().Close(); err != nil {
-			logger.Error("failed to close redis connection", err, nil)
-		}
-	}()
-
-	dbConn, err := sqlx.Open("postgres", os.Getenv("POSTGRES_URL"))
+	dbConn, err := openDB()
 	if err != nil {
-		return fmt.Errorf("connecting to db: %w", err)
+		return err
 	}
-	defer func() {
-		if err := dbConn.Close(); err != nil {
-			logger.Error("failed to close db connection", err, nil)
-		}
-	}()
+	defer closeDB(dbConn, logger)
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer cancel()
+	messageBroker, closeBroker, err := newBroker(os.Getenv("MESSAGE_BROKER"), dbConn, logger)
+	if err != nil {
+		return err
+	}
+	defer closeBroker()
 
 	deadNationClient := clients.NewDeadNationClient(gatewayClient)
 	filesClient := clients.NewFilesClient(gatewayClient)
@@ -60,15 +92,30 @@ func run(logger watermill.LoggerAdapter) error {
 	receiptsClient := clients.NewReceiptsClient(gatewayClient)
 	spreadsheetsClient := clients.NewSpreadsheetsClient(gatewayClient)
 
+	var seatHoldTTL time.Duration
+	if v := os.Getenv("SEAT_HOLD_TTL"); v != "" {
+		if seatHoldTTL, err = time.ParseDuration(v); err != nil {
+			return fmt.Errorf("parsing SEAT_HOLD_TTL: %w", err)
+		}
+	}
+
+	refundPolicy, err := newRefundPolicy()
+	if err != nil {
+		return err
+	}
+
 	svc, err := service.New(service.Deps{
+		Broker:             messageBroker,
 		DB:                 dbConn,
 		DeadNationBooker:   deadNationClient,
 		Logger:             logger,
 		PaymentsClient:     paymentsClient,
 		ReceiptsClient:     receiptsClient,
-		RedisClient:        redisClient,
 		SpreadsheetsClient: spreadsheetsClient,
 		FilesClient:        filesClient,
+		SkipMigrations:     os.Getenv("SKIP_MIGRATIONS") == "true",
+		SeatHoldTTL:        seatHoldTTL,
+		RefundPolicy:       refundPolicy,
 	})
 	if err != nil {
 		return fmt.Errorf("creating service: %w", err)
@@ -76,3 +123,178 @@ func run(logger watermill.LoggerAdapter) error {
 
 	return svc.Run(ctx)
 }
+
+// newRefundPolicy reads the refund policy from REFUND_CUTOFF, such as "24h",
+// and REFUND_TIERS, such as "168h=50,72h=25".
+func newRefundPolicy() (refund.Policy, error) {
+	var cutoff time.Duration
+	if v := os.Getenv("REFUND_CUTOFF"); v != "" {
+		var err error
+		if cutoff, err = time.ParseDuration(v); err != nil {
+			return refund.Policy{}, fmt.Errorf("parsing REFUND_CUTOFF: %w", err)
+		}
+	}
+
+	tiers, err := refund.ParseTiers(os.Getenv("REFUND_TIERS"))
+	if err != nil {
+		return refund.Policy{}, fmt.Errorf("parsing REFUND_TIERS: %w", err)
+	}
+
+	policy, err := refund.NewPolicy(cutoff, tiers)
+	if err != nil {
+		return refund.Policy{}, fmt.Errorf("creating refund policy: %w", err)
+	}
+
+	return policy, nil
+}
+
+// migrate runs "migrate up" or "migrate down <version>".
+func migrate(ctx context.Context, args []string, logger watermill.LoggerAdapter) error {
+	dbConn, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer closeDB(dbConn, logger)
+
+	if len(args) == 0 || args[0] == "up" {
+		if err := postgres.Migrate(ctx, dbConn); err != nil {
+			return fmt.Errorf("migrating db: %w", err)
+		}
+
+		return nil
+	}
+
+	if args[0] == "down" && len(args) == 2 {
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("parsing target version: %w", err)
+		}
+
+		if err := postgres.MigrateDown(ctx, dbConn, version); err != nil {
+			return fmt.Errorf("reverting db migrations: %w", err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("usage: migrate [up | down <version>]")
+}
+
+// replayEvents publishes stored events to a single handler's consumer group:
+//
+//	replay-events -handler store-confirmed-in-db [-from 2024-01-01T00:00:00Z] [-to 2024-02-01T00:00:00Z]
+func replayEvents(ctx context.Context, args []string, logger watermill.LoggerAdapter) error {
+	flags := flag.NewFlagSet("replay-events", flag.ContinueOnError)
+	handlerName := flags.String("handler", "", "name of the event handler to replay events to")
+	from := flags.String("from", "", "replay events published at or after this RFC 3339 time")
+	to := flags.String("to", "", "replay events published before this RFC 3339 time")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	eventName, err := message.EventNameForHandler(*handlerName)
+	if err != nil {
+		return err
+	}
+
+	filter := entity.StoredEventFilter{EventName: eventName}
+	if filter.From, err = parseOptionalTime(*from); err != nil {
+		return fmt.Errorf("parsing from: %w", err)
+	}
+	if filter.To, err = parseOptionalTime(*to); err != nil {
+		return fmt.Errorf("parsing to: %w", err)
+	}
+
+	dbConn, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer closeDB(dbConn, logger)
+
+	messageBroker, closeBroker, err := newBroker(os.Getenv("MESSAGE_BROKER"), dbConn, logger)
+	if err != nil {
+		return err
+	}
+	defer closeBroker()
+
+	if _, ok := messageBroker.(*broker.Memory); ok {
+		return fmt.Errorf("replaying events needs a broker shared with the running service")
+	}
+
+	events, err := postgres.NewEventStoreRepo(dbConn).List(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("listing stored events: %w", err)
+	}
+
+	if err := message.ReplayEvents(ctx, messageBroker.Publisher(), *handlerName, events); err != nil {
+		return fmt.Errorf("replaying events: %w", err)
+	}
+
+	logger.Info("replayed events", watermill.LogFields{"handler": *handlerName, "count": len(events)})
+
+	return nil
+}
+
+// newBroker creates the message broker selected by MESSAGE_BROKER: "redis"
+// (the default), "postgres", which uses the service database, or "memory",
+// which keeps messages in this process only.
+func newBroker(kind string, dbConn *sqlx.DB, logger watermill.LoggerAdapter) (broker.Broker, func(), error) {
+	switch kind {
+	case "", "redis":
+		redisClient := redis.NewClient(&redis.Options{
+			Addr: os.Getenv("REDIS_ADDR"),
+		})
+		closeRedis := func() {
+			if err := redisClient.Close(); err != nil {
+				logger.Error("failed to close redis connection", err, nil)
+			}
+		}
+
+		b, err := broker.NewRedis(redisClient, logger)
+		if err != nil {
+			closeRedis()
+			return nil, nil, fmt.Errorf("creating redis broker: %w", err)
+		}
+
+		return b, closeRedis, nil
+	case "postgres":
+		b, err := broker.NewSQL(dbConn, logger)
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating postgres broker: %w", err)
+		}
+
+		return b, func() {}, nil
+	case "memory":
+		return broker.NewMemory(), func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown message broker %q", kind)
+	}
+}
+
+func parseOptionalTime(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func openDB() (*sqlx.DB, error) {
+	dbConn, err := sqlx.Open("postgres", os.Getenv("POSTGRES_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to db: %w", err)
+	}
+
+	return dbConn, nil
+}
+
+func closeDB(dbConn *sqlx.DB, logger watermill.LoggerAdapter) {
+	if err := dbConn.Close(); err != nil {
+		logger.Error("failed to close db connection", err, nil)
+	}
+}
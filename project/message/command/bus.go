@@ -1,15 +1,20 @@
 package command
 
 import (
+	"strings"
+
 	"github.com/ThreeDotsLabs/watermill"
-	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
 	"github.com/ThreeDotsLabs/watermill/components/cqrs"
 	"github.com/ThreeDotsLabs/watermill/message"
-	"github.com/redis/go-redis/v9"
 )
 
 const topicPrefix = "commands."
 
+// IsTopic reports whether commands are sent on the topic.
+func IsTopic(topic string) bool {
+	return strings.HasPrefix(topic, topicPrefix)
+}
+
 func NewBus(publisher message.Publisher, logger watermill.LoggerAdapter) (*cqrs.CommandBus, error) {
 	return cqrs.NewCommandBusWithConfig(publisher, cqrs.CommandBusConfig{
 		GeneratePublishTopic: func(params cqrs.CommandBusGeneratePublishTopicParams) (string, error) {
@@ -22,13 +27,14 @@ func NewBus(publisher message.Publisher, logger watermill.LoggerAdapter) (*cqrs.
 	})
 }
 
-func NewProcessorConfig(logger watermill.LoggerAdapter, redisClient *redis.Client) cqrs.CommandProcessorConfig {
+type SubscriberFactory interface {
+	NewSubscriber(consumerGroup string) (message.Subscriber, error)
+}
+
+func NewProcessorConfig(logger watermill.LoggerAdapter, subscribers SubscriberFactory) cqrs.CommandProcessorConfig {
 	return cqrs.CommandProcessorConfig{
 		SubscriberConstructor: func(params cqrs.CommandProcessorSubscriberConstructorParams) (message.Subscriber, error) {
-			return redisstream.NewSubscriber(redisstream.SubscriberConfig{
-				Client:        redisClient,
-				ConsumerGroup: "svc-tickets." + params.HandlerName,
-			}, logger)
+			return subscribers.NewSubscriber("svc-tickets." + params.HandlerName)
 		},
 		GenerateSubscribeTopic: func(params cqrs.CommandProcessorGenerateSubscribeTopicParams) (string, error) {
 			return topicPrefix + params.CommandName, nil
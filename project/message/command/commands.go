@@ -3,6 +3,8 @@ package command
 import (
 	"time"
 
+	"tickets/entity"
+
 	"github.com/ThreeDotsLabs/watermill"
 )
 
@@ -22,12 +24,17 @@ func newHeader(idempotencyKey string) header {
 
 type RefundTicket struct {
 	TicketID string `json:"ticket_id"`
-	Header   header
+	RefundID string `json:"refund_id"`
+	// Amount is the part of the price to refund. Nil refunds the whole price.
+	Amount *entity.Money `json:"amount,omitempty"`
+	Header header
 }
 
-func NewRefundTicket(ticketID, idempotencyKey string) RefundTicket {
+func NewRefundTicket(refundID, ticketID, idempotencyKey string, amount *entity.Money) RefundTicket {
 	return RefundTicket{
 		Header:   newHeader(idempotencyKey),
 		TicketID: ticketID,
+		RefundID: refundID,
+		Amount:   amount,
 	}
 }
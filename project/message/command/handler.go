@@ -2,36 +2,89 @@ package command
 
 import (
 	"context"
+	"errors"
 	"fmt"
+
+	"tickets/entity"
 )
 
 type PaymentsClient interface {
-	RefundPayment(ctx context.Context, idempotencyKey string, ticketID string) error
+	RefundPayment(ctx context.Context, idempotencyKey string, ticketID string, amount *entity.Money) error
 }
 
 type ReceiptsClient interface {
 	VoidReceipt(ctx context.Context, idempotencyKey, ticketID string) error
 }
 
+type RefundRepo interface {
+	MarkPaymentRefunded(ctx context.Context, refundID string) error
+	Complete(ctx context.Context, refundID string) error
+	Fail(ctx context.Context, refundID, reason string) error
+}
+
+// StepJournal runs each step of a command at most once per idempotency key,
+// so a command redelivered after a failed step skips the steps before it.
+type StepJournal interface {
+	RunStep(ctx context.Context, commandName, idempotencyKey, step string, run func() error) error
+}
+
+type permanentError interface {
+	error
+	Permanent() bool
+}
+
 type Handler struct {
-	payments PaymentsClient
-	receipts ReceiptsClient
+	payments   PaymentsClient
+	receipts   ReceiptsClient
+	refundRepo RefundRepo
+	steps      StepJournal
 }
 
-func NewHandler(p PaymentsClient, r ReceiptsClient) Handler {
+func NewHandler(p PaymentsClient, r ReceiptsClient, rr RefundRepo, s StepJournal) Handler {
 	return Handler{
-		payments: p,
-		receipts: r,
+		payments:   p,
+		receipts:   r,
+		refundRepo: rr,
+		steps:      s,
 	}
 }
 
 func (h Handler) RefundTicket(ctx context.Context, cmd *RefundTicket) error {
-	if err := h.payments.RefundPayment(ctx, cmd.Header.IdempotencyKey, cmd.TicketID); err != nil {
-		return fmt.Errorf("refunding payment: %w", err)
+	err := h.steps.RunStep(ctx, "RefundTicket", cmd.Header.IdempotencyKey, "refund-payment", func() error {
+		return h.payments.RefundPayment(ctx, cmd.Header.IdempotencyKey, cmd.TicketID, cmd.Amount)
+	})
+	if err != nil {
+		return h.failRefund(ctx, cmd, fmt.Errorf("refunding payment: %w", err))
+	}
+
+	if err := h.refundRepo.MarkPaymentRefunded(ctx, cmd.RefundID); err != nil {
+		return fmt.Errorf("marking payment refunded: %w", err)
+	}
+
+	err = h.steps.RunStep(ctx, "RefundTicket", cmd.Header.IdempotencyKey, "void-receipt", func() error {
+		return h.receipts.VoidReceipt(ctx, cmd.Header.IdempotencyKey, cmd.TicketID)
+	})
+	if err != nil {
+		return h.failRefund(ctx, cmd, fmt.Errorf("voiding ticket receipt: %w", err))
+	}
+
+	if err := h.refundRepo.Complete(ctx, cmd.RefundID); err != nil {
+		return fmt.Errorf("completing refund: %w", err)
+	}
+
+	return nil
+}
+
+// failRefund marks the refund failed if err won't go away on retry, and
+// returns err for the command to be retried otherwise.
+func (h Handler) failRefund(ctx context.Context, cmd *RefundTicket, err error) error {
+	var permanentErr permanentError
+	if !errors.As(err, &permanentErr) {
+		return err
 	}
 
-	if err := h.receipts.VoidReceipt(ctx, cmd.Header.IdempotencyKey, cmd.TicketID); err != nil {
-		return fmt.Errorf("voiding ticket receipt: %w", err)
+	if err := h.refundRepo.Fail(ctx, cmd.RefundID, err.Error()); err != nil {
+		return fmt.Errorf("failing refund: %w", err)
 	}
 
 	return nil
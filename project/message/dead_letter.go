@@ -0,0 +1,167 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"tickets/broker"
+	"tickets/entity"
+	"tickets/message/command"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+const deadLetterTopic = "dead_letter_queue"
+
+var poisonedMetadataKeys = []string{
+	middleware.ReasonForPoisonedKey,
+	middleware.PoisonedTopicKey,
+	middleware.PoisonedHandlerKey,
+	middleware.PoisonedSubscriberKey,
+}
+
+type deadLetterNotFoundError struct {
+	id string
+}
+
+func (e deadLetterNotFoundError) Error() string {
+	return fmt.Sprintf("dead letter %s not found", e.id)
+}
+
+func (e deadLetterNotFoundError) NotFound() bool {
+	return true
+}
+
+// DeadLetterStore gives random access to the messages in the dead letter topic.
+type DeadLetterStore interface {
+	Messages(ctx context.Context, topic string) ([]broker.StoredMessage, error)
+	Message(ctx context.Context, topic, id string) (broker.StoredMessage, bool, error)
+	DeleteMessage(ctx context.Context, topic, id string) (bool, error)
+}
+
+type DeadLetterQueue struct {
+	store     DeadLetterStore
+	publisher message.Publisher
+}
+
+func NewDeadLetterQueue(store DeadLetterStore, publisher message.Publisher) DeadLetterQueue {
+	return DeadLetterQueue{
+		store:     store,
+		publisher: publisher,
+	}
+}
+
+func (q DeadLetterQueue) List(ctx context.Context) ([]entity.DeadLetter, error) {
+	messages, err := q.store.Messages(ctx, deadLetterTopic)
+	if err != nil {
+		return nil, fmt.Errorf("reading dead letter queue: %w", err)
+	}
+
+	deadLetters := make([]entity.DeadLetter, 0, len(messages))
+	for _, msg := range messages {
+		deadLetters = append(deadLetters, toDeadLetter(msg))
+	}
+
+	return deadLetters, nil
+}
+
+func (q DeadLetterQueue) Get(ctx context.Context, id string) (entity.DeadLetter, error) {
+	msg, err := q.get(ctx, id)
+	if err != nil {
+		return entity.DeadLetter{}, err
+	}
+
+	return toDeadLetter(msg), nil
+}
+
+// Replay publishes the dead-lettered message again for the handler that failed
+// to handle it, and removes it from the dead letter queue. Events go to the
+// handler's replay topic, so other handlers of the event don't see them twice.
+func (q DeadLetterQueue) Replay(ctx context.Context, id string) error {
+	stored, err := q.get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	msg := stored.Message
+	topic, err := replayTopicFor(msg)
+	if err != nil {
+		return fmt.Errorf("dead letter %s: %w", id, err)
+	}
+
+	for _, key := range poisonedMetadataKeys {
+		delete(msg.Metadata, key)
+	}
+	msg.SetContext(ctx)
+
+	if err := q.publisher.Publish(topic, msg); err != nil {
+		return fmt.Errorf("republishing dead letter %s: %w", id, err)
+	}
+
+	return q.Discard(ctx, id)
+}
+
+// replayTopicFor returns the topic that delivers the message only to the
+// handler that poisoned it. Commands have a single handler, so they go back to
+// their original topic. Messages of any other handler aren't replayed, as
+// their original topic would deliver them to every handler of the event.
+func replayTopicFor(msg *message.Message) (string, error) {
+	topic := msg.Metadata.Get(middleware.PoisonedTopicKey)
+	if topic == "" {
+		return "", errors.New("no original topic")
+	}
+
+	handlerName := strings.TrimSuffix(msg.Metadata.Get(middleware.PoisonedHandlerKey), replayHandlerSuffix)
+	if isEventStoreHandler(handlerName) {
+		return ReplayTopic(eventStoreHandlerName), nil
+	}
+	if _, err := EventNameForHandler(handlerName); err == nil {
+		return ReplayTopic(handlerName), nil
+	}
+	if command.IsTopic(topic) {
+		return topic, nil
+	}
+
+	return "", fmt.Errorf("no replay topic for handler %s", handlerName)
+}
+
+func (q DeadLetterQueue) Discard(ctx context.Context, id string) error {
+	deleted, err := q.store.DeleteMessage(ctx, deadLetterTopic, id)
+	if err != nil {
+		return fmt.Errorf("deleting dead letter %s: %w", id, err)
+	}
+
+	if !deleted {
+		return deadLetterNotFoundError{id: id}
+	}
+
+	return nil
+}
+
+func (q DeadLetterQueue) get(ctx context.Context, id string) (broker.StoredMessage, error) {
+	msg, ok, err := q.store.Message(ctx, deadLetterTopic, id)
+	if err != nil {
+		return broker.StoredMessage{}, fmt.Errorf("reading dead letter %s: %w", id, err)
+	}
+
+	if !ok {
+		return broker.StoredMessage{}, deadLetterNotFoundError{id: id}
+	}
+
+	return msg, nil
+}
+
+func toDeadLetter(msg broker.StoredMessage) entity.DeadLetter {
+	return entity.DeadLetter{
+		ID:          msg.ID,
+		MessageUUID: msg.Message.UUID,
+		Handler:     msg.Message.Metadata.Get(middleware.PoisonedHandlerKey),
+		Topic:       msg.Message.Metadata.Get(middleware.PoisonedTopicKey),
+		Error:       msg.Message.Metadata.Get(middleware.ReasonForPoisonedKey),
+		Payload:     string(msg.Message.Payload),
+		Metadata:    msg.Message.Metadata,
+	}
+}
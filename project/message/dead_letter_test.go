@@ -0,0 +1,110 @@
+package message_test
+
+import (
+	"context"
+	"testing"
+
+	"tickets/broker"
+	"tickets/message"
+
+	"github.com/ThreeDotsLabs/watermill"
+	watermillMessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterQueue_Replay(t *testing.T) {
+	const confirmedTopic = "events.TicketBookingConfirmed"
+
+	testCases := []struct {
+		name          string
+		topic         string
+		handlerName   string
+		expectedTopic string
+	}{
+		{
+			name:          "event handler",
+			topic:         confirmedTopic,
+			handlerName:   "issue-receipt",
+			expectedTopic: message.ReplayTopic("issue-receipt"),
+		},
+		{
+			name:          "event handler replay",
+			topic:         message.ReplayTopic("issue-receipt"),
+			handlerName:   "issue-receipt.replay",
+			expectedTopic: message.ReplayTopic("issue-receipt"),
+		},
+		{
+			name:          "event store",
+			topic:         confirmedTopic,
+			handlerName:   "store-event." + confirmedTopic,
+			expectedTopic: message.ReplayTopic("store-event"),
+		},
+		{
+			name:          "event store replay",
+			topic:         message.ReplayTopic("store-event"),
+			handlerName:   "store-event.replay",
+			expectedTopic: message.ReplayTopic("store-event"),
+		},
+		{
+			name:          "command",
+			topic:         refundTopic,
+			handlerName:   "RefundTicket",
+			expectedTopic: refundTopic,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			b := broker.NewMemory()
+			queue := message.NewDeadLetterQueue(b, b.Publisher())
+
+			id := deadLetter(t, b, tc.topic, tc.handlerName)
+			require.NoError(t, queue.Replay(ctx, id))
+
+			assert.Len(t, messages(t, b, tc.expectedTopic), 1)
+			if tc.expectedTopic != tc.topic {
+				assert.Empty(t, messages(t, b, tc.topic), "original topic should not be replayed to")
+			}
+			assert.Empty(t, messages(t, b, "dead_letter_queue"))
+		})
+	}
+
+	t.Run("unknown handler", func(t *testing.T) {
+		ctx := context.Background()
+		b := broker.NewMemory()
+		queue := message.NewDeadLetterQueue(b, b.Publisher())
+
+		id := deadLetter(t, b, confirmedTopic, "unknown-handler")
+		assert.Error(t, queue.Replay(ctx, id))
+
+		assert.Empty(t, messages(t, b, confirmedTopic))
+		assert.Len(t, messages(t, b, "dead_letter_queue"), 1, "dead letter should be kept")
+	})
+}
+
+func deadLetter(t *testing.T, b *broker.Memory, topic, handlerName string) string {
+	t.Helper()
+
+	msg := watermillMessage.NewMessage(watermill.NewUUID(), []byte(`{}`))
+	msg.Metadata.Set(middleware.PoisonedTopicKey, topic)
+	msg.Metadata.Set(middleware.PoisonedHandlerKey, handlerName)
+	msg.Metadata.Set(middleware.ReasonForPoisonedKey, "failed")
+	require.NoError(t, b.Publisher().Publish("dead_letter_queue", msg))
+
+	stored := messages(t, b, "dead_letter_queue")
+	require.Len(t, stored, 1)
+
+	return stored[0].ID
+}
+
+func messages(t *testing.T, b *broker.Memory, topic string) []broker.StoredMessage {
+	t.Helper()
+
+	stored, err := b.Messages(context.Background(), topic)
+	require.NoError(t, err)
+
+	return stored
+}
@@ -2,18 +2,20 @@ package event
 
 import (
 	"github.com/ThreeDotsLabs/watermill"
-	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
 	"github.com/ThreeDotsLabs/watermill/components/cqrs"
 	"github.com/ThreeDotsLabs/watermill/message"
-	"github.com/redis/go-redis/v9"
 )
 
 const topicPrefix = "events."
 
+func Topic(eventName string) string {
+	return topicPrefix + eventName
+}
+
 func NewBus(publisher message.Publisher, logger watermill.LoggerAdapter) (*cqrs.EventBus, error) {
 	return cqrs.NewEventBusWithConfig(publisher, cqrs.EventBusConfig{
 		GeneratePublishTopic: func(params cqrs.GenerateEventPublishTopicParams) (string, error) {
-			return topicPrefix + params.EventName, nil
+			return Topic(params.EventName), nil
 		},
 		Marshaler: cqrs.JSONMarshaler{
 			GenerateName: cqrs.StructName,
@@ -22,16 +24,17 @@ func NewBus(publisher message.Publisher, logger watermill.LoggerAdapter) (*cqrs.
 	})
 }
 
-func NewProcessorConfig(logger watermill.LoggerAdapter, redisClient *redis.Client) cqrs.EventProcessorConfig {
+type SubscriberFactory interface {
+	NewSubscriber(consumerGroup string) (message.Subscriber, error)
+}
+
+func NewProcessorConfig(logger watermill.LoggerAdapter, subscribers SubscriberFactory) cqrs.EventProcessorConfig {
 	return cqrs.EventProcessorConfig{
 		SubscriberConstructor: func(params cqrs.EventProcessorSubscriberConstructorParams) (message.Subscriber, error) {
-			return redisstream.NewSubscriber(redisstream.SubscriberConfig{
-				Client:        redisClient,
-				ConsumerGroup: "svc-tickets." + params.HandlerName,
-			}, logger)
+			return subscribers.NewSubscriber("svc-tickets." + params.HandlerName)
 		},
 		GenerateSubscribeTopic: func(params cqrs.EventProcessorGenerateSubscribeTopicParams) (string, error) {
-			return topicPrefix + params.EventName, nil
+			return Topic(params.EventName), nil
 		},
 		Marshaler: cqrs.JSONMarshaler{
 			GenerateName: cqrs.StructName,
@@ -6,8 +6,34 @@ import (
 	"tickets/entity"
 
 	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
 )
 
+// all lists every event the service publishes, so that catch-all subscribers
+// know which topics to read.
+var all = []any{
+	TicketBookingConfirmed{},
+	TicketBookingCanceled{},
+	TicketPrinted{},
+	BookingMade{},
+	BookingCanceled{},
+	DeadNationBookingCreated{},
+	DeadNationBookingFailed{},
+	BookingFailed{},
+	WaitlistSeatOffered{},
+	TicketRefunded{},
+	TicketRefundFailed{},
+}
+
+func Topics() []string {
+	topics := make([]string, 0, len(all))
+	for _, e := range all {
+		topics = append(topics, Topic(cqrs.StructName(e)))
+	}
+
+	return topics
+}
+
 type header struct {
 	ID             string    `json:"id"`
 	PublishedAt    time.Time `json:"published_at"`
@@ -25,6 +51,7 @@ func newHeader(idempotencyKey string) header {
 type TicketBookingConfirmed struct {
 	Header        header       `json:"header"`
 	TicketID      string       `json:"ticket_id"`
+	BookingID     string       `json:"booking_id,omitempty"`
 	CustomerEmail string       `json:"customer_email"`
 	Price         entity.Money `json:"price"`
 }
@@ -33,6 +60,7 @@ func NewTicketBookingConfirmed(idempotencyKey string, ticket entity.Ticket) Tick
 	return TicketBookingConfirmed{
 		Header:        newHeader(idempotencyKey),
 		TicketID:      ticket.ID,
+		BookingID:     ticket.BookingID,
 		CustomerEmail: ticket.CustomerEmail,
 		Price: entity.Money{
 			Amount:   ticket.Price.Amount,
@@ -44,6 +72,7 @@ func NewTicketBookingConfirmed(idempotencyKey string, ticket entity.Ticket) Tick
 type TicketBookingCanceled struct {
 	Header        header       `json:"header"`
 	TicketID      string       `json:"ticket_id"`
+	BookingID     string       `json:"booking_id,omitempty"`
 	CustomerEmail string       `json:"customer_email"`
 	Price         entity.Money `json:"price"`
 }
@@ -52,6 +81,7 @@ func NewTicketBookingCanceled(idempotencyKey string, ticket entity.Ticket) Ticke
 	return TicketBookingCanceled{
 		Header:        newHeader(idempotencyKey),
 		TicketID:      ticket.ID,
+		BookingID:     ticket.BookingID,
 		CustomerEmail: ticket.CustomerEmail,
 		Price: entity.Money{
 			Amount:   ticket.Price.Amount,
@@ -74,7 +104,90 @@ func NewTicketPrinted(idempotencyKey, ticketID, fileName string) TicketPrinted {
 	}
 }
 
+type TicketRefunded struct {
+	Header   header `json:"header"`
+	RefundID string `json:"refund_id"`
+	TicketID string `json:"ticket_id"`
+}
+
+func NewTicketRefunded(idempotencyKey string, refund entity.Refund) TicketRefunded {
+	return TicketRefunded{
+		Header:   newHeader(idempotencyKey),
+		RefundID: refund.RefundID,
+		TicketID: refund.TicketID,
+	}
+}
+
+type TicketRefundFailed struct {
+	Header   header `json:"header"`
+	RefundID string `json:"refund_id"`
+	TicketID string `json:"ticket_id"`
+	Reason   string `json:"reason"`
+}
+
+func NewTicketRefundFailed(idempotencyKey string, refund entity.Refund) TicketRefundFailed {
+	return TicketRefundFailed{
+		Header:   newHeader(idempotencyKey),
+		RefundID: refund.RefundID,
+		TicketID: refund.TicketID,
+		Reason:   refund.FailureReason,
+	}
+}
+
 type BookingMade struct {
+	Header          header          `json:"header"`
+	BookingID       string          `json:"booking_id"`
+	ShowID          string          `json:"show_id"`
+	NumberOfTickets uint            `json:"number_of_tickets"`
+	CustomerEmail   string          `json:"customer_email"`
+	Tickets         []BookedTickets `json:"tickets,omitempty"`
+	TotalPrice      *entity.Money   `json:"total_price,omitempty"`
+	Discount        *Discount       `json:"discount,omitempty"`
+}
+
+// Discount is the amount a promo code took off the booking's total price.
+type Discount struct {
+	PromoCode string       `json:"promo_code"`
+	Amount    entity.Money `json:"amount"`
+}
+
+type BookedTickets struct {
+	Category  string       `json:"category"`
+	Quantity  uint         `json:"quantity"`
+	UnitPrice entity.Money `json:"unit_price"`
+}
+
+func NewBookingMade(idempotencyKey string, booking entity.Booking) BookingMade {
+	var tickets []BookedTickets
+	for _, item := range booking.Items {
+		tickets = append(tickets, BookedTickets{
+			Category:  item.Category,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+		})
+	}
+
+	var discount *Discount
+	if booking.Discount != nil {
+		discount = &Discount{
+			PromoCode: booking.PromoCode,
+			Amount:    *booking.Discount,
+		}
+	}
+
+	return BookingMade{
+		Header:          newHeader(idempotencyKey),
+		BookingID:       booking.BookingID,
+		ShowID:          booking.ShowID,
+		NumberOfTickets: booking.NumberOfTickets,
+		CustomerEmail:   booking.CustomerEmail,
+		Tickets:         tickets,
+		TotalPrice:      booking.TotalPrice,
+		Discount:        discount,
+	}
+}
+
+type BookingCanceled struct {
 	Header          header `json:"header"`
 	BookingID       string `json:"booking_id"`
 	ShowID          string `json:"show_id"`
@@ -82,8 +195,8 @@ type BookingMade struct {
 	CustomerEmail   string `json:"customer_email"`
 }
 
-func NewBookingMade(idempotencyKey string, booking entity.Booking) BookingMade {
-	return BookingMade{
+func NewBookingCanceled(idempotencyKey string, booking entity.Booking) BookingCanceled {
+	return BookingCanceled{
 		Header:          newHeader(idempotencyKey),
 		BookingID:       booking.BookingID,
 		ShowID:          booking.ShowID,
@@ -91,3 +204,71 @@ func NewBookingMade(idempotencyKey string, booking entity.Booking) BookingMade {
 		CustomerEmail:   booking.CustomerEmail,
 	}
 }
+
+type DeadNationBookingCreated struct {
+	Header    header `json:"header"`
+	BookingID string `json:"booking_id"`
+}
+
+func NewDeadNationBookingCreated(idempotencyKey, bookingID string) DeadNationBookingCreated {
+	return DeadNationBookingCreated{
+		Header:    newHeader(idempotencyKey),
+		BookingID: bookingID,
+	}
+}
+
+type DeadNationBookingFailed struct {
+	Header    header `json:"header"`
+	BookingID string `json:"booking_id"`
+	Reason    string `json:"reason"`
+}
+
+func NewDeadNationBookingFailed(idempotencyKey, bookingID, reason string) DeadNationBookingFailed {
+	return DeadNationBookingFailed{
+		Header:    newHeader(idempotencyKey),
+		BookingID: bookingID,
+		Reason:    reason,
+	}
+}
+
+type BookingFailed struct {
+	Header          header `json:"header"`
+	BookingID       string `json:"booking_id"`
+	ShowID          string `json:"show_id"`
+	NumberOfTickets uint   `json:"number_of_tickets"`
+	CustomerEmail   string `json:"customer_email"`
+	Reason          string `json:"reason"`
+}
+
+func NewBookingFailed(idempotencyKey string, booking entity.Booking, reason string) BookingFailed {
+	return BookingFailed{
+		Header:          newHeader(idempotencyKey),
+		BookingID:       booking.BookingID,
+		ShowID:          booking.ShowID,
+		NumberOfTickets: booking.NumberOfTickets,
+		CustomerEmail:   booking.CustomerEmail,
+		Reason:          reason,
+	}
+}
+
+type WaitlistSeatOffered struct {
+	Header          header    `json:"header"`
+	EntryID         string    `json:"entry_id"`
+	ShowID          string    `json:"show_id"`
+	HoldID          string    `json:"hold_id"`
+	NumberOfTickets uint      `json:"number_of_tickets"`
+	CustomerEmail   string    `json:"customer_email"`
+	ClaimExpiresAt  time.Time `json:"claim_expires_at"`
+}
+
+func NewWaitlistSeatOffered(idempotencyKey string, entry entity.WaitlistEntry, hold entity.SeatHold) WaitlistSeatOffered {
+	return WaitlistSeatOffered{
+		Header:          newHeader(idempotencyKey),
+		EntryID:         entry.EntryID,
+		ShowID:          entry.ShowID,
+		HoldID:          hold.HoldID,
+		NumberOfTickets: hold.NumberOfTickets,
+		CustomerEmail:   entry.CustomerEmail,
+		ClaimExpiresAt:  hold.ExpiresAt,
+	}
+}
@@ -2,7 +2,11 @@ package event
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/big"
+	"strconv"
+	"time"
 
 	"tickets/entity"
 )
@@ -11,6 +15,26 @@ type ShowRepo interface {
 	Get(ctx context.Context, showID string) (entity.Show, error)
 }
 
+type BookingRepo interface {
+	Get(ctx context.Context, bookingID string) (entity.Booking, error)
+	ReceiptPrice(ctx context.Context, bookingID, ticketID string, share entity.Money) (entity.Money, error)
+}
+
+type BookingSagaRepo interface {
+	Confirm(ctx context.Context, bookingID string) error
+	Fail(ctx context.Context, bookingID, reason string) error
+}
+
+type notFoundError interface {
+	error
+	NotFound() bool
+}
+
+type permanentError interface {
+	error
+	Permanent() bool
+}
+
 type DeadNationBooker interface {
 	CreateBooking(ctx context.Context, deadNationID string, booking entity.Booking) error
 }
@@ -32,11 +56,18 @@ type TicketGenerator interface {
 }
 
 type TicketRepo interface {
-	Add(ctx context.Context, ticket entity.Ticket) error
-	Delete(ctx context.Context, ticketID string) error
+	Add(ctx context.Context, ticket entity.Ticket, publishedAt time.Time) error
+	Cancel(ctx context.Context, ticket entity.Ticket, publishedAt time.Time) error
+	SetStatus(ctx context.Context, ticketID, status string, publishedAt time.Time) error
+}
+
+type WaitlistRepo interface {
+	OfferSeats(ctx context.Context, showID string) error
 }
 
 type Handler struct {
+	bookingRepo         BookingRepo
+	bookingSagaRepo     BookingSagaRepo
 	deadNationBooker    DeadNationBooker
 	publisher           Publisher
 	receiptsClient      ReceiptsClient
@@ -44,9 +75,12 @@ type Handler struct {
 	spreadsheetAppender SpreadsheetAppender
 	ticketGenerator     TicketGenerator
 	ticketRepo          TicketRepo
+	waitlistRepo        WaitlistRepo
 }
 
 func NewHandler(
+	b BookingRepo,
+	bs BookingSagaRepo,
 	d DeadNationBooker,
 	p Publisher,
 	r ReceiptsClient,
@@ -54,8 +88,11 @@ func NewHandler(
 	sa SpreadsheetAppender,
 	tg TicketGenerator,
 	tr TicketRepo,
+	w WaitlistRepo,
 ) Handler {
 	return Handler{
+		bookingRepo:         b,
+		bookingSagaRepo:     bs,
 		deadNationBooker:    d,
 		publisher:           p,
 		receiptsClient:      r,
@@ -63,6 +100,7 @@ func NewHandler(
 		spreadsheetAppender: sa,
 		ticketGenerator:     tg,
 		ticketRepo:          tr,
+		waitlistRepo:        w,
 	}
 }
 
@@ -78,10 +116,74 @@ func (h Handler) CreateDeadNationBooking(ctx context.Context, e *BookingMade) er
 		NumberOfTickets: e.NumberOfTickets,
 		ShowID:          e.ShowID,
 	}
-	if err := h.deadNationBooker.CreateBooking(ctx, show.DeadNationID, booking); err != nil {
+	err = h.deadNationBooker.CreateBooking(ctx, show.DeadNationID, booking)
+	var permanentErr permanentError
+	if errors.As(err, &permanentErr) {
+		failed := NewDeadNationBookingFailed(e.Header.IdempotencyKey, e.BookingID, err.Error())
+		if err := h.publisher.Publish(ctx, failed); err != nil {
+			return fmt.Errorf("publishing dead nation booking failed event: %w", err)
+		}
+
+		return nil
+	}
+
+	if err != nil {
 		return fmt.Errorf("creating dead nation booking: %w", err)
 	}
 
+	created := NewDeadNationBookingCreated(e.Header.IdempotencyKey, e.BookingID)
+	if err := h.publisher.Publish(ctx, created); err != nil {
+		return fmt.Errorf("publishing dead nation booking created event: %w", err)
+	}
+
+	return nil
+}
+
+func (h Handler) ConfirmBookingSaga(ctx context.Context, e *DeadNationBookingCreated) error {
+	if err := h.bookingSagaRepo.Confirm(ctx, e.BookingID); err != nil {
+		return fmt.Errorf("confirming booking saga: %w", err)
+	}
+
+	return nil
+}
+
+func (h Handler) FailBookingSaga(ctx context.Context, e *DeadNationBookingFailed) error {
+	if err := h.bookingSagaRepo.Fail(ctx, e.BookingID, e.Reason); err != nil {
+		return fmt.Errorf("failing booking saga: %w", err)
+	}
+
+	return nil
+}
+
+// CancelDeadNationBooking adds the canceled booking to the tracker of bookings
+// to cancel in Dead Nation by hand, as its API has no way to cancel them.
+func (h Handler) CancelDeadNationBooking(ctx context.Context, e *BookingCanceled) error {
+	show, err := h.showRepo.Get(ctx, e.ShowID)
+	if err != nil {
+		return fmt.Errorf("getting show: %w", err)
+	}
+
+	row := []string{e.BookingID, show.DeadNationID, strconv.FormatUint(uint64(e.NumberOfTickets), 10), e.CustomerEmail}
+	if err := h.spreadsheetAppender.AppendRow(ctx, "dead-nation-bookings-to-cancel", row); err != nil {
+		return fmt.Errorf("failed to append row to tracker: %w", err)
+	}
+
+	return nil
+}
+
+func (h Handler) OfferWaitlistSeatsCanceled(ctx context.Context, e *BookingCanceled) error {
+	if err := h.waitlistRepo.OfferSeats(ctx, e.ShowID); err != nil {
+		return fmt.Errorf("offering waitlist seats: %w", err)
+	}
+
+	return nil
+}
+
+func (h Handler) OfferWaitlistSeatsFailed(ctx context.Context, e *BookingFailed) error {
+	if err := h.waitlistRepo.OfferSeats(ctx, e.ShowID); err != nil {
+		return fmt.Errorf("offering waitlist seats: %w", err)
+	}
+
 	return nil
 }
 
@@ -96,6 +198,11 @@ func (h Handler) IssueReceipt(ctx context.Context, e *TicketBookingConfirmed) er
 		Currency: currency,
 	}
 
+	price, err := h.discountedPrice(ctx, e.BookingID, e.TicketID, price)
+	if err != nil {
+		return err
+	}
+
 	if err := h.receiptsClient.IssueReceipt(ctx, e.Header.IdempotencyKey, e.TicketID, price); err != nil {
 		return err
 	}
@@ -103,6 +210,62 @@ func (h Handler) IssueReceipt(ctx context.Context, e *TicketBookingConfirmed) er
 	return nil
 }
 
+// discountedPrice takes the promo code discount of the ticket's booking off
+// the ticket's price, in the same proportion as off the booking's total. The
+// booking repo puts the rounding remainder on the booking's last ticket, so
+// the ticket receipts add up to what the customer paid. Tickets of bookings
+// made elsewhere keep their price.
+func (h Handler) discountedPrice(ctx context.Context, bookingID, ticketID string, price entity.Money) (entity.Money, error) {
+	if bookingID == "" {
+		return price, nil
+	}
+
+	booking, err := h.bookingRepo.Get(ctx, bookingID)
+	var notFoundErr notFoundError
+	if errors.As(err, &notFoundErr) {
+		return price, nil
+	}
+	if err != nil {
+		return entity.Money{}, fmt.Errorf("getting booking: %w", err)
+	}
+
+	if booking.Discount == nil || booking.TotalPrice == nil {
+		return price, nil
+	}
+
+	amount, ok := new(big.Rat).SetString(price.Amount)
+	if !ok {
+		return entity.Money{}, fmt.Errorf("invalid ticket price %s", price.Amount)
+	}
+	total, ok := new(big.Rat).SetString(booking.TotalPrice.Amount)
+	if !ok {
+		return entity.Money{}, fmt.Errorf("invalid booking total price %s", booking.TotalPrice.Amount)
+	}
+	discount, ok := new(big.Rat).SetString(booking.Discount.Amount)
+	if !ok {
+		return entity.Money{}, fmt.Errorf("invalid booking discount %s", booking.Discount.Amount)
+	}
+
+	beforeDiscount := new(big.Rat).Add(total, discount)
+	if beforeDiscount.Sign() == 0 {
+		return price, nil
+	}
+
+	amount.Mul(amount, total)
+	amount.Quo(amount, beforeDiscount)
+
+	share := entity.Money{
+		Amount:   amount.FloatString(2),
+		Currency: price.Currency,
+	}
+	price, err = h.bookingRepo.ReceiptPrice(ctx, bookingID, ticketID, share)
+	if err != nil {
+		return entity.Money{}, fmt.Errorf("getting receipt price: %w", err)
+	}
+
+	return price, nil
+}
+
 func (h Handler) AppendToTrackerConfirmed(ctx context.Context, e *TicketBookingConfirmed) error {
 	currency := e.Price.Currency
 	if currency == "" {
@@ -129,17 +292,35 @@ func (h Handler) AppendToTrackerCanceled(ctx context.Context, e *TicketBookingCa
 func (h Handler) StoreInDB(ctx context.Context, e *TicketBookingConfirmed) error {
 	t := entity.Ticket{
 		ID:            e.TicketID,
+		BookingID:     e.BookingID,
 		CustomerEmail: e.CustomerEmail,
 		Price: entity.Money{
 			Amount:   e.Price.Amount,
 			Currency: e.Price.Currency,
 		},
 	}
-	return h.ticketRepo.Add(ctx, t)
+	return h.ticketRepo.Add(ctx, t, e.Header.PublishedAt)
+}
+
+func (h Handler) MarkCanceledInDB(ctx context.Context, e *TicketBookingCanceled) error {
+	t := entity.Ticket{
+		ID:            e.TicketID,
+		BookingID:     e.BookingID,
+		CustomerEmail: e.CustomerEmail,
+		Price: entity.Money{
+			Amount:   e.Price.Amount,
+			Currency: e.Price.Currency,
+		},
+	}
+	return h.ticketRepo.Cancel(ctx, t, e.Header.PublishedAt)
+}
+
+func (h Handler) MarkRefundedInDB(ctx context.Context, e *TicketRefunded) error {
+	return h.ticketRepo.SetStatus(ctx, e.TicketID, entity.StatusRefunded, e.Header.PublishedAt)
 }
 
-func (h Handler) RemoveCanceledFromDB(ctx context.Context, e *TicketBookingCanceled) error {
-	return h.ticketRepo.Delete(ctx, e.TicketID)
+func (h Handler) MarkPrintedInDB(ctx context.Context, e *TicketPrinted) error {
+	return h.ticketRepo.SetStatus(ctx, e.TicketID, entity.StatusPrinted, e.Header.PublishedAt)
 }
 
 func (h Handler) PrintTicket(ctx context.Context, e *TicketBookingConfirmed) error {
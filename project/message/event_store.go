@@ -0,0 +1,82 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"tickets/entity"
+	"tickets/message/event"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+const eventStoreHandlerName = "store-event"
+
+type EventStore interface {
+	Append(ctx context.Context, e entity.StoredEvent) error
+}
+
+// addEventStoreHandlers subscribes to every event topic with a single consumer
+// group and appends each event to the event store. Events the store failed to
+// append are replayed on its own replay topic, which no other handler reads.
+func addEventStoreHandlers(router *message.Router, config cqrs.EventProcessorConfig, store EventStore) error {
+	subscriber, err := config.SubscriberConstructor(cqrs.EventProcessorSubscriberConstructorParams{
+		HandlerName: eventStoreHandlerName,
+	})
+	if err != nil {
+		return fmt.Errorf("creating subscriber: %w", err)
+	}
+
+	appendEvent := func(msg *message.Message) error {
+		if err := store.Append(msg.Context(), newStoredEvent(msg)); err != nil {
+			return fmt.Errorf("appending event to store: %w", err)
+		}
+
+		return nil
+	}
+
+	for _, topic := range event.Topics() {
+		router.AddNoPublisherHandler(eventStoreHandlerName+"."+topic, topic, subscriber, appendEvent)
+	}
+
+	router.AddNoPublisherHandler(
+		eventStoreHandlerName+replayHandlerSuffix,
+		ReplayTopic(eventStoreHandlerName),
+		subscriber,
+		appendEvent,
+	)
+
+	return nil
+}
+
+func isEventStoreHandler(handlerName string) bool {
+	return handlerName == eventStoreHandlerName || strings.HasPrefix(handlerName, eventStoreHandlerName+".")
+}
+
+func newStoredEvent(msg *message.Message) entity.StoredEvent {
+	var payload struct {
+		Header struct {
+			PublishedAt time.Time `json:"published_at"`
+		} `json:"header"`
+	}
+	_ = json.Unmarshal(msg.Payload, &payload)
+
+	publishedAt := payload.Header.PublishedAt
+	if publishedAt.IsZero() {
+		publishedAt = time.Now().UTC()
+	}
+
+	return entity.StoredEvent{
+		EventID:       msg.UUID,
+		EventName:     cqrs.JSONMarshaler{}.NameFromMessage(msg),
+		Payload:       msg.Payload,
+		Metadata:      msg.Metadata,
+		CorrelationID: middleware.MessageCorrelationID(msg),
+		PublishedAt:   publishedAt,
+	}
+}
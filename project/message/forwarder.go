@@ -1,18 +1,14 @@
 package message
 
 import (
-	"context"
-	"database/sql"
 	"fmt"
 
 	"github.com/ThreeDotsLabs/go-event-driven/common/log"
 	"github.com/ThreeDotsLabs/watermill"
-	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
 	watermillSQL "github.com/ThreeDotsLabs/watermill-sql/v2/pkg/sql"
-	"github.com/ThreeDotsLabs/watermill/components/cqrs"
 	"github.com/ThreeDotsLabs/watermill/components/forwarder"
+	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/jmoiron/sqlx"
-	"github.com/redis/go-redis/v9"
 )
 
 const outboxTopic = "events_to_forward"
@@ -23,7 +19,7 @@ type Forwarder struct {
 
 func NewForwarder(
 	db *sqlx.DB,
-	rdb *redis.Client,
+	publisher message.Publisher,
 	logger watermill.LoggerAdapter,
 ) (*Forwarder, error) {
 	subscriber, err := watermillSQL.NewSubscriber(db, watermillSQL.SubscriberConfig{
@@ -38,14 +34,13 @@ func NewForwarder(
 		return nil, fmt.Errorf("initialising subscriber: %w", err)
 	}
 
-	publisher, err := redisstream.NewPublisher(redisstream.PublisherConfig{
-		Client: rdb,
-	}, logger)
-	if err != nil {
-		return nil, fmt.Errorf("creating publisher: %w", err)
+	decoratedPublisher := log.CorrelationPublisherDecorator{
+		Publisher: TracingPublisherDecorator{Publisher: publisher, SpanName: "forward"},
 	}
 
-	decoratedPublisher := log.CorrelationPublisherDecorator{Publisher: publisher}
+	if err := registerOutboxBacklogGauge(db); err != nil {
+		return nil, fmt.Errorf("registering outbox backlog gauge: %w", err)
+	}
 
 	f, err := forwarder.NewForwarder(subscriber, decoratedPublisher, logger, forwarder.Config{
 		ForwarderTopic: outboxTopic,
@@ -56,44 +51,3 @@ func NewForwarder(
 
 	return &Forwarder{f}, nil
 }
-
-func PublishInTx(
-	ctx context.Context,
-	event any,
-	tx *sql.Tx,
-) error {
-	sqlPublisher, err := watermillSQL.NewPublisher(
-		tx,
-		watermillSQL.PublisherConfig{
-			SchemaAdapter: watermillSQL.DefaultPostgreSQLSchema{},
-		},
-		log.NewWatermill(log.FromContext(ctx)),
-	)
-	if err != nil {
-		return fmt.Errorf("creating sql publisher: %w", err)
-	}
-
-	publisher := forwarder.NewPublisher(sqlPublisher, forwarder.PublisherConfig{
-		ForwarderTopic: outboxTopic,
-	})
-
-	decoratedPublisher := log.CorrelationPublisherDecorator{Publisher: publisher}
-
-	eventBus, err := cqrs.NewEventBusWithConfig(decoratedPublisher, cqrs.EventBusConfig{
-		GeneratePublishTopic: func(params cqrs.GenerateEventPublishTopicParams) (string, error) {
-			return params.EventName, nil
-		},
-		Marshaler: cqrs.JSONMarshaler{
-			GenerateName: cqrs.StructName,
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("creating sql event bus: %w", err)
-	}
-
-	if err := eventBus.Publish(ctx, event); err != nil {
-		return fmt.Errorf("publishing event: %w", err)
-	}
-
-	return nil
-}
@@ -0,0 +1,116 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	messagesProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tickets",
+		Name:      "messages_processed_total",
+		Help:      "Messages handled successfully, by handler.",
+	}, []string{"handler"})
+	messagesFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tickets",
+		Name:      "messages_failed_total",
+		Help:      "Messages that failed after all retries, by handler.",
+	}, []string{"handler"})
+	messagesRetried = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tickets",
+		Name:      "messages_retried_total",
+		Help:      "Handler retries, by handler.",
+	}, []string{"handler"})
+	messageHandlingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "tickets",
+		Name:      "message_handling_duration_seconds",
+		Help:      "Time spent handling a message including retries, by handler.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"handler"})
+)
+
+type attemptsCtxKey struct{}
+
+// metricsMiddleware must wrap the retry middleware, with countAttemptsMiddleware
+// inside it, so that retries of a single message are counted.
+func metricsMiddleware(next message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		handlerName := message.HandlerNameFromCtx(msg.Context())
+		start := time.Now()
+
+		attempts := new(int)
+		msg.SetContext(context.WithValue(msg.Context(), attemptsCtxKey{}, attempts))
+
+		msgs, err := next(msg)
+
+		messageHandlingDuration.WithLabelValues(handlerName).Observe(time.Since(start).Seconds())
+		if *attempts > 1 {
+			messagesRetried.WithLabelValues(handlerName).Add(float64(*attempts - 1))
+		}
+		if err != nil {
+			messagesFailed.WithLabelValues(handlerName).Inc()
+		} else {
+			messagesProcessed.WithLabelValues(handlerName).Inc()
+		}
+
+		return msgs, err
+	}
+}
+
+func countAttemptsMiddleware(next message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		if attempts, ok := msg.Context().Value(attemptsCtxKey{}).(*int); ok {
+			*attempts++
+		}
+
+		return next(msg)
+	}
+}
+
+// registerOutboxBacklogGauge exposes the number of outbox messages not yet
+// forwarded. The query mirrors how the SQL subscriber selects the next messages.
+func registerOutboxBacklogGauge(db *sqlx.DB) error {
+	query := fmt.Sprintf(`WITH last_processed AS (
+			SELECT coalesce(MAX(offset_acked), 0) AS offset_acked,
+				coalesce(MAX(last_processed_transaction_id::text), '0')::xid8 AS last_processed_transaction_id
+			FROM "watermill_offsets_%[1]s" WHERE consumer_group = ''
+		)
+		SELECT count(*) FROM "watermill_%[1]s"
+		WHERE (transaction_id = (SELECT last_processed_transaction_id FROM last_processed)
+				AND "offset" > (SELECT offset_acked FROM last_processed))
+			OR transaction_id > (SELECT last_processed_transaction_id FROM last_processed)`, outboxTopic)
+
+	gauge := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   "tickets",
+		Name:        "outbox_backlog_messages",
+		Help:        "Messages in the outbox waiting to be forwarded.",
+		ConstLabels: prometheus.Labels{"topic": outboxTopic},
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		var backlog int
+		if err := db.GetContext(ctx, &backlog, query); err != nil {
+			logrus.WithError(err).Warn("Failed to count outbox backlog")
+			return 0
+		}
+
+		return float64(backlog)
+	})
+
+	err := prometheus.Register(gauge)
+	var alreadyRegisteredErr prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegisteredErr) {
+		return nil
+	}
+
+	return err
+}
@@ -1,20 +1,34 @@
 package message
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"time"
 
+	"tickets/entity"
+
 	"github.com/ThreeDotsLabs/go-event-driven/common/log"
 	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
 	"github.com/lithammer/shortuuid/v3"
 	"github.com/sirupsen/logrus"
 )
 
-func addMiddlewares(router *message.Router, logger watermill.LoggerAdapter) {
+func addMiddlewares(router *message.Router, poisonQueuePublisher message.Publisher, blocklist MessageBlocklist, inbox Inbox, logger watermill.LoggerAdapter) error {
+	poisonQueueMiddleware, err := middleware.PoisonQueue(poisonQueuePublisher, deadLetterTopic)
+	if err != nil {
+		return fmt.Errorf("creating poison queue middleware: %w", err)
+	}
+
+	router.AddMiddleware(tracingMiddleware)
 	router.AddMiddleware(correlationIDMiddleware)
 	router.AddMiddleware(loggerMiddleware)
+	router.AddMiddleware(poisonQueueMiddleware)
 	router.AddMiddleware(handlerLogMiddleware)
+	router.AddMiddleware(metricsMiddleware)
 	router.AddMiddleware(middleware.Retry{
 		MaxRetries:      10,
 		InitialInterval: time.Millisecond * 100,
@@ -22,7 +36,11 @@ func addMiddlewares(router *message.Router, logger watermill.LoggerAdapter) {
 		Multiplier:      2,
 		Logger:          logger,
 	}.Middleware)
-	router.AddMiddleware(skipInvalidEventsMiddleware)
+	router.AddMiddleware(countAttemptsMiddleware)
+	router.AddMiddleware(skipBlockedMessagesMiddleware(blocklist))
+	router.AddMiddleware(deduplicationMiddleware(inbox))
+
+	return nil
 }
 
 func correlationIDMiddleware(next message.HandlerFunc) message.HandlerFunc {
@@ -66,15 +84,87 @@ func handlerLogMiddleware(next message.HandlerFunc) message.HandlerFunc {
 	}
 }
 
-func skipInvalidEventsMiddleware(next message.HandlerFunc) message.HandlerFunc {
-	return func(msg *message.Message) ([]*message.Message, error) {
-		logger := log.FromContext(msg.Context())
+type MessageBlocklist interface {
+	Blocked(ctx context.Context, messageUUID, eventName, handlerName string) (entity.BlocklistEntry, bool, error)
+}
 
-		if msg.UUID == "2beaf5bc-d5e4-4653-b075-2b36bbf28949" {
-			logger.Info("Skipping message with uuid 2beaf5bc-d5e4-4653-b075-2b36bbf28949")
-			return nil, nil
+func skipBlockedMessagesMiddleware(blocklist MessageBlocklist) message.HandlerMiddleware {
+	return func(next message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			eventName := cqrs.JSONMarshaler{}.NameFromMessage(msg)
+			handlerName := message.HandlerNameFromCtx(msg.Context())
+
+			entry, blocked, err := blocklist.Blocked(msg.Context(), msg.UUID, eventName, handlerName)
+			if err != nil {
+				return nil, fmt.Errorf("checking message blocklist: %w", err)
+			}
+
+			if blocked {
+				log.FromContext(msg.Context()).WithFields(logrus.Fields{
+					"blocklist_entry_id": entry.EntryID,
+					"event_name":         eventName,
+					"handler_name":       handlerName,
+					"reason":             entry.Reason,
+				}).Warn("Skipping blocklisted message")
+				return nil, nil
+			}
+
+			return next(msg)
 		}
+	}
+}
 
-		return next(msg)
+type Inbox interface {
+	ProcessOnce(ctx context.Context, handlerName, messageKey string, handle func() error) (bool, error)
+}
+
+func deduplicationMiddleware(inbox Inbox) message.HandlerMiddleware {
+	return func(next message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			handlerName := message.HandlerNameFromCtx(msg.Context())
+			messageKey := deduplicationKey(msg)
+
+			var msgs []*message.Message
+			duplicate, err := inbox.ProcessOnce(msg.Context(), handlerName, messageKey, func() error {
+				var err error
+				msgs, err = next(msg)
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			if duplicate {
+				log.FromContext(msg.Context()).WithFields(logrus.Fields{
+					"handler_name": handlerName,
+					"message_key":  messageKey,
+				}).Info("Skipping already processed message")
+				return nil, nil
+			}
+
+			return msgs, nil
+		}
 	}
 }
+
+// deduplicationKey identifies a message by its event name and the idempotency
+// key or ID from its header, falling back to the message UUID.
+func deduplicationKey(msg *message.Message) string {
+	var payload struct {
+		Header struct {
+			ID             string `json:"id"`
+			IdempotencyKey string `json:"idempotency_key"`
+		} `json:"header"`
+	}
+	_ = json.Unmarshal(msg.Payload, &payload)
+
+	key := payload.Header.IdempotencyKey
+	if key == "" {
+		key = payload.Header.ID
+	}
+	if key == "" {
+		key = msg.UUID
+	}
+
+	return cqrs.JSONMarshaler{}.NameFromMessage(msg) + ":" + key
+}
@@ -0,0 +1,88 @@
+package message
+
+import (
+	"context"
+	"fmt"
+
+	"tickets/entity"
+	"tickets/message/event"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+const (
+	replayTopicPrefix   = "replay."
+	replayHandlerSuffix = ".replay"
+)
+
+// replayEventHandler handles events replayed to a single handler. It shares the
+// consumer group of the wrapped handler but reads from the handler's own replay
+// topic, so replayed events are not seen by any other handler.
+type replayEventHandler struct {
+	cqrs.EventHandler
+}
+
+func (h replayEventHandler) HandlerName() string {
+	return h.EventHandler.HandlerName() + replayHandlerSuffix
+}
+
+func ReplayTopic(handlerName string) string {
+	return replayTopicPrefix + handlerName
+}
+
+func addReplayHandlers(router *message.Router, config cqrs.EventProcessorConfig, handlers []cqrs.EventHandler) error {
+	replayConfig := config
+	replayConfig.GenerateSubscribeTopic = func(params cqrs.EventProcessorGenerateSubscribeTopicParams) (string, error) {
+		return ReplayTopic(params.EventHandler.(replayEventHandler).EventHandler.HandlerName()), nil
+	}
+	replayConfig.SubscriberConstructor = func(params cqrs.EventProcessorSubscriberConstructorParams) (message.Subscriber, error) {
+		handler := params.EventHandler.(replayEventHandler).EventHandler
+
+		return config.SubscriberConstructor(cqrs.EventProcessorSubscriberConstructorParams{
+			HandlerName:  handler.HandlerName(),
+			EventHandler: handler,
+		})
+	}
+
+	processor, err := cqrs.NewEventProcessorWithConfig(router, replayConfig)
+	if err != nil {
+		return fmt.Errorf("creating replay event processor: %w", err)
+	}
+
+	for _, h := range handlers {
+		if err := processor.AddHandlers(replayEventHandler{h}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EventNameForHandler returns the name of the event handled by the named event handler.
+func EventNameForHandler(handlerName string) (string, error) {
+	for _, h := range newEventHandlers(event.Handler{}) {
+		if h.HandlerName() == handlerName {
+			return cqrs.StructName(h.NewEvent()), nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown event handler %s", handlerName)
+}
+
+// ReplayEvents publishes stored events to the replay topic of the named handler.
+func ReplayEvents(ctx context.Context, publisher message.Publisher, handlerName string, events []entity.StoredEvent) error {
+	for _, e := range events {
+		msg := message.NewMessage(e.EventID, e.Payload)
+		for k, v := range e.Metadata {
+			msg.Metadata.Set(k, v)
+		}
+		msg.SetContext(ctx)
+
+		if err := publisher.Publish(ReplayTopic(handlerName), msg); err != nil {
+			return fmt.Errorf("publishing event %s: %w", e.EventID, err)
+		}
+	}
+
+	return nil
+}
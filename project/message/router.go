@@ -14,46 +14,54 @@ type Router struct {
 	*message.Router
 }
 
-func NewRouter(
-	commandHandler command.Handler,
-	commandProcessorConfig cqrs.CommandProcessorConfig,
-	eventHandler event.Handler,
-	eventProcessorConfig cqrs.EventProcessorConfig,
-	logger watermill.LoggerAdapter,
-) (*Router, error) {
-	router, err := message.NewRouter(message.RouterConfig{}, logger)
+type RouterDeps struct {
+	Blocklist              MessageBlocklist
+	CommandHandler         command.Handler
+	CommandProcessorConfig cqrs.CommandProcessorConfig
+	EventHandler           event.Handler
+	EventProcessorConfig   cqrs.EventProcessorConfig
+	EventStore             EventStore
+	Inbox                  Inbox
+	Logger                 watermill.LoggerAdapter
+	PoisonQueuePublisher   message.Publisher
+}
+
+func NewRouter(deps RouterDeps) (*Router, error) {
+	router, err := message.NewRouter(message.RouterConfig{}, deps.Logger)
 	if err != nil {
 		return nil, fmt.Errorf("creating router: %w", err)
 	}
 
-	addMiddlewares(router, logger)
+	if err := addMiddlewares(router, deps.PoisonQueuePublisher, deps.Blocklist, deps.Inbox, deps.Logger); err != nil {
+		return nil, fmt.Errorf("adding middlewares: %w", err)
+	}
 
-	eventProcessor, err := cqrs.NewEventProcessorWithConfig(router, eventProcessorConfig)
+	eventProcessor, err := cqrs.NewEventProcessorWithConfig(router, deps.EventProcessorConfig)
 	if err != nil {
 		return nil, fmt.Errorf("creating event processor: %w", err)
 	}
 
-	eventHandlers := []cqrs.EventHandler{
-		cqrs.NewEventHandler("create-dead-nation-booking", eventHandler.CreateDeadNationBooking),
-		cqrs.NewEventHandler("issue-receipt", eventHandler.IssueReceipt),
-		cqrs.NewEventHandler("append-to-tracker-confirmed", eventHandler.AppendToTrackerConfirmed),
-		cqrs.NewEventHandler("append-to-tracker-canceled", eventHandler.AppendToTrackerCanceled),
-		cqrs.NewEventHandler("store-confirmed-in-db", eventHandler.StoreInDB),
-		cqrs.NewEventHandler("remove-canceled-from-db", eventHandler.RemoveCanceledFromDB),
-		cqrs.NewEventHandler("print-ticket", eventHandler.PrintTicket),
-	}
+	eventHandlers := newEventHandlers(deps.EventHandler)
 
 	if err := eventProcessor.AddHandlers(eventHandlers...); err != nil {
 		return nil, fmt.Errorf("adding event handlers: %w", err)
 	}
 
-	cmdProcessor, err := cqrs.NewCommandProcessorWithConfig(router, commandProcessorConfig)
+	if err := addReplayHandlers(router, deps.EventProcessorConfig, eventHandlers); err != nil {
+		return nil, fmt.Errorf("adding replay handlers: %w", err)
+	}
+
+	if err := addEventStoreHandlers(router, deps.EventProcessorConfig, deps.EventStore); err != nil {
+		return nil, fmt.Errorf("adding event store handlers: %w", err)
+	}
+
+	cmdProcessor, err := cqrs.NewCommandProcessorWithConfig(router, deps.CommandProcessorConfig)
 	if err != nil {
 		return nil, fmt.Errorf("creating command processor: %w", err)
 	}
 
 	cmdHandlers := []cqrs.CommandHandler{
-		cqrs.NewCommandHandler("refund-ticket", commandHandler.RefundTicket),
+		cqrs.NewCommandHandler("refund-ticket", deps.CommandHandler.RefundTicket),
 	}
 
 	if err := cmdProcessor.AddHandlers(cmdHandlers...); err != nil {
@@ -62,3 +70,23 @@ func NewRouter(
 
 	return &Router{router}, nil
 }
+
+func newEventHandlers(eventHandler event.Handler) []cqrs.EventHandler {
+	return []cqrs.EventHandler{
+		cqrs.NewEventHandler("create-dead-nation-booking", eventHandler.CreateDeadNationBooking),
+		cqrs.NewEventHandler("cancel-dead-nation-booking", eventHandler.CancelDeadNationBooking),
+		cqrs.NewEventHandler("confirm-booking-saga", eventHandler.ConfirmBookingSaga),
+		cqrs.NewEventHandler("fail-booking-saga", eventHandler.FailBookingSaga),
+		cqrs.NewEventHandler("offer-waitlist-seats-canceled", eventHandler.OfferWaitlistSeatsCanceled),
+		cqrs.NewEventHandler("offer-waitlist-seats-failed", eventHandler.OfferWaitlistSeatsFailed),
+		cqrs.NewEventHandler("issue-receipt", eventHandler.IssueReceipt),
+		cqrs.NewEventHandler("append-to-tracker-confirmed", eventHandler.AppendToTrackerConfirmed),
+		cqrs.NewEventHandler("append-to-tracker-canceled", eventHandler.AppendToTrackerCanceled),
+		cqrs.NewEventHandler("store-confirmed-in-db", eventHandler.StoreInDB),
+		// Named before canceled tickets were kept; renaming it would start a new consumer group.
+		cqrs.NewEventHandler("remove-canceled-from-db", eventHandler.MarkCanceledInDB),
+		cqrs.NewEventHandler("mark-printed-in-db", eventHandler.MarkPrintedInDB),
+		cqrs.NewEventHandler("mark-refunded-in-db", eventHandler.MarkRefundedInDB),
+		cqrs.NewEventHandler("print-ticket", eventHandler.PrintTicket),
+	}
+}
@@ -0,0 +1,65 @@
+package message
+
+import (
+	"tickets/tracing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingPublisherDecorator starts a producer span for every published message
+// and stores its trace context in the message metadata. Messages without a span
+// in their context, like those relayed by the forwarder, continue the trace
+// stored in their metadata.
+type TracingPublisherDecorator struct {
+	message.Publisher
+	SpanName string
+}
+
+func (d TracingPublisherDecorator) Publish(topic string, messages ...*message.Message) error {
+	spans := make([]trace.Span, 0, len(messages))
+	for _, msg := range messages {
+		ctx := msg.Context()
+		if !trace.SpanContextFromContext(ctx).IsValid() {
+			ctx = tracing.ExtractFromMessage(ctx, msg)
+		}
+
+		ctx, span := tracing.Tracer().Start(ctx, d.SpanName+" "+topic,
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(tracing.MessagingAttributes(topic, msg)...),
+		)
+		tracing.InjectToMessage(ctx, msg)
+		msg.SetContext(ctx)
+		spans = append(spans, span)
+	}
+
+	err := d.Publisher.Publish(topic, messages...)
+
+	for _, span := range spans {
+		tracing.RecordError(span, err)
+		span.End()
+	}
+
+	return err
+}
+
+func tracingMiddleware(next message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		handlerName := message.HandlerNameFromCtx(msg.Context())
+		topic := message.SubscribeTopicFromCtx(msg.Context())
+
+		ctx := tracing.ExtractFromMessage(msg.Context(), msg)
+		ctx, span := tracing.Tracer().Start(ctx, "handle "+handlerName,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(tracing.MessagingAttributes(topic, msg)...),
+		)
+		defer span.End()
+
+		msg.SetContext(ctx)
+
+		msgs, err := next(msg)
+		tracing.RecordError(span, err)
+
+		return msgs, err
+	}
+}
@@ -0,0 +1,134 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"tickets/message/command"
+	"tickets/message/event"
+
+	"github.com/ThreeDotsLabs/go-event-driven/common/log"
+	"github.com/ThreeDotsLabs/watermill"
+	watermillSQL "github.com/ThreeDotsLabs/watermill-sql/v2/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/ThreeDotsLabs/watermill/components/forwarder"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// TxBus publishes events and sends commands as part of a database
+// transaction, so they are only sent if the transaction commits. With the
+// outbox, messages are written to the forwarder topic and forwarded to the
+// broker after commit. Without it, they are written straight to their topics,
+// which is only useful when Postgres itself is the broker.
+//
+// A TxBus is created once and used with every transaction.
+type TxBus struct {
+	eventBus   *cqrs.EventBus
+	commandBus *cqrs.CommandBus
+}
+
+func NewOutboxTxBus(logger watermill.LoggerAdapter) (TxBus, error) {
+	return newTxBus(logger, true)
+}
+
+func NewDirectTxBus(logger watermill.LoggerAdapter) (TxBus, error) {
+	return newTxBus(logger, false)
+}
+
+func newTxBus(logger watermill.LoggerAdapter, outbox bool) (TxBus, error) {
+	spanName := "publish in transaction"
+	if outbox {
+		spanName = "publish to outbox"
+	}
+
+	publisher := log.CorrelationPublisherDecorator{
+		Publisher: TracingPublisherDecorator{
+			Publisher: txPublisher{outbox: outbox, logger: logger},
+			SpanName:  spanName,
+		},
+	}
+
+	eventBus, err := event.NewBus(publisher, logger)
+	if err != nil {
+		return TxBus{}, fmt.Errorf("creating event bus: %w", err)
+	}
+
+	commandBus, err := command.NewBus(publisher, logger)
+	if err != nil {
+		return TxBus{}, fmt.Errorf("creating command bus: %w", err)
+	}
+
+	return TxBus{
+		eventBus:   eventBus,
+		commandBus: commandBus,
+	}, nil
+}
+
+// Publish publishes the events in tx, which can be a *sql.Tx or a *sqlx.Tx.
+func (b TxBus) Publish(ctx context.Context, tx watermillSQL.ContextExecutor, events ...any) error {
+	ctx = context.WithValue(ctx, txContextKey{}, tx)
+	for _, e := range events {
+		if err := b.eventBus.Publish(ctx, e); err != nil {
+			return fmt.Errorf("publishing event: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Send sends the command in tx, which can be a *sql.Tx or a *sqlx.Tx.
+func (b TxBus) Send(ctx context.Context, tx watermillSQL.ContextExecutor, cmd any) error {
+	ctx = context.WithValue(ctx, txContextKey{}, tx)
+	if err := b.commandBus.Send(ctx, cmd); err != nil {
+		return fmt.Errorf("sending command: %w", err)
+	}
+
+	return nil
+}
+
+type txContextKey struct{}
+
+// txPublisher writes messages with an SQL publisher on the transaction the
+// buses put in the messages' context. The SQL publisher is tied to its
+// transaction, so it's the only part created for every publish.
+type txPublisher struct {
+	outbox bool
+	logger watermill.LoggerAdapter
+}
+
+func (p txPublisher) Publish(topic string, messages ...*message.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	// Messages published together come from a single bus call.
+	tx, ok := messages[0].Context().Value(txContextKey{}).(watermillSQL.ContextExecutor)
+	if !ok {
+		return errors.New("no transaction to publish in")
+	}
+
+	sqlPublisher, err := watermillSQL.NewPublisher(
+		tx,
+		watermillSQL.PublisherConfig{
+			SchemaAdapter: watermillSQL.DefaultPostgreSQLSchema{},
+		},
+		p.logger,
+	)
+	if err != nil {
+		return fmt.Errorf("creating sql publisher: %w", err)
+	}
+
+	var publisher message.Publisher = sqlPublisher
+	if p.outbox {
+		publisher = forwarder.NewPublisher(sqlPublisher, forwarder.PublisherConfig{
+			ForwarderTopic: outboxTopic,
+		})
+	}
+
+	return publisher.Publish(topic, messages...)
+}
+
+func (p txPublisher) Close() error {
+	return nil
+}
@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"tickets/entity"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+type blocklistEntryNotFoundError struct {
+	entryID string
+}
+
+func (e blocklistEntryNotFoundError) Error() string {
+	return fmt.Sprintf("blocklist entry %s not found", e.entryID)
+}
+
+func (e blocklistEntryNotFoundError) NotFound() bool {
+	return true
+}
+
+type BlocklistRepo struct {
+	db *sqlx.DB
+}
+
+func NewBlocklistRepo(db *sqlx.DB) BlocklistRepo {
+	return BlocklistRepo{
+		db: db,
+	}
+}
+
+func (r BlocklistRepo) Add(ctx context.Context, entry entity.BlocklistEntry) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO message_blocklist
+		(entry_id, message_uuid, event_name, handler_name, reason, expires_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''), $5, $6);`,
+		entry.EntryID, entry.MessageUUID, entry.EventName, entry.HandlerName, entry.Reason, entry.ExpiresAt)
+	return err
+}
+
+func (r BlocklistRepo) Delete(ctx context.Context, entryID string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM message_blocklist WHERE entry_id = $1", entryID)
+	if err != nil {
+		return fmt.Errorf("executing delete query: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting rows affected: %w", err)
+	}
+	if n == 0 {
+		return blocklistEntryNotFoundError{entryID: entryID}
+	}
+
+	return nil
+}
+
+func (r BlocklistRepo) List(ctx context.Context) ([]entity.BlocklistEntry, error) {
+	rows, err := r.db.QueryxContext(ctx, `SELECT entry_id, coalesce(message_uuid, ''), coalesce(event_name, ''),
+		coalesce(handler_name, ''), reason, expires_at, created_at, skipped_count, last_skipped_at
+		FROM message_blocklist ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("querying db: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []entity.BlocklistEntry
+	for rows.Next() {
+		var e entity.BlocklistEntry
+		if err := rows.Scan(&e.EntryID, &e.MessageUUID, &e.EventName, &e.HandlerName, &e.Reason,
+			&e.ExpiresAt, &e.CreatedAt, &e.SkippedCount, &e.LastSkippedAt); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// Blocked reports whether an unexpired entry matches the message, counting the
+// skip against every matching entry.
+func (r BlocklistRepo) Blocked(ctx context.Context, messageUUID, eventName, handlerName string) (entity.BlocklistEntry, bool, error) {
+	rows, err := r.db.QueryxContext(ctx, `UPDATE message_blocklist
+		SET skipped_count = skipped_count + 1, last_skipped_at = now()
+		WHERE (message_uuid IS NULL OR message_uuid = $1)
+			AND (event_name IS NULL OR event_name = $2)
+			AND (handler_name IS NULL OR handler_name = $3)
+			AND (expires_at IS NULL OR expires_at > now())
+		RETURNING entry_id, coalesce(message_uuid, ''), coalesce(event_name, ''), coalesce(handler_name, ''), reason`,
+		messageUUID, eventName, handlerName)
+	if err != nil {
+		return entity.BlocklistEntry{}, false, fmt.Errorf("querying db: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return entity.BlocklistEntry{}, false, rows.Err()
+	}
+
+	var e entity.BlocklistEntry
+	if err := rows.Scan(&e.EntryID, &e.MessageUUID, &e.EventName, &e.HandlerName, &e.Reason); err != nil {
+		return entity.BlocklistEntry{}, false, fmt.Errorf("scanning row: %w", err)
+	}
+
+	return e, true, nil
+}
@@ -0,0 +1,62 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"tickets/entity"
+	"tickets/postgres"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlocklistRepo_Blocked(t *testing.T) {
+	ctx := context.Background()
+	r := postgres.NewBlocklistRepo(db)
+
+	handlerName := "handler-" + uuid.NewString()
+	entry := entity.BlocklistEntry{
+		EntryID:     uuid.NewString(),
+		EventName:   "TicketBookingConfirmed",
+		HandlerName: handlerName,
+		Reason:      "broken handler",
+	}
+	require.NoError(t, r.Add(ctx, entry))
+
+	matched, blocked, err := r.Blocked(ctx, uuid.NewString(), "TicketBookingConfirmed", handlerName)
+	require.NoError(t, err)
+	assert.True(t, blocked)
+	assert.Equal(t, entry.EntryID, matched.EntryID)
+	assert.Equal(t, "broken handler", matched.Reason)
+
+	_, blocked, err = r.Blocked(ctx, uuid.NewString(), "TicketBookingCanceled", handlerName)
+	require.NoError(t, err)
+	assert.False(t, blocked)
+
+	require.NoError(t, r.Delete(ctx, entry.EntryID))
+
+	_, blocked, err = r.Blocked(ctx, uuid.NewString(), "TicketBookingConfirmed", handlerName)
+	require.NoError(t, err)
+	assert.False(t, blocked)
+}
+
+func TestBlocklistRepo_Blocked_Expired(t *testing.T) {
+	ctx := context.Background()
+	r := postgres.NewBlocklistRepo(db)
+
+	expiresAt := time.Now().Add(-time.Minute)
+	messageUUID := uuid.NewString()
+	require.NoError(t, r.Add(ctx, entity.BlocklistEntry{
+		EntryID:     uuid.NewString(),
+		MessageUUID: messageUUID,
+		Reason:      "expired",
+		ExpiresAt:   &expiresAt,
+	}))
+
+	_, blocked, err := r.Blocked(ctx, messageUUID, "TicketBookingConfirmed", "print-ticket")
+	require.NoError(t, err)
+	assert.False(t, blocked)
+}
@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"tickets/entity"
+	"tickets/message/event"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+type bookingSagaNotFoundError struct {
+	bookingID string
+}
+
+func (e bookingSagaNotFoundError) Error() string {
+	return fmt.Sprintf("booking saga %s not found", e.bookingID)
+}
+
+func (e bookingSagaNotFoundError) NotFound() bool {
+	return true
+}
+
+type BookingSagaRepo struct {
+	db  *sqlx.DB
+	bus TxBus
+}
+
+func NewBookingSagaRepo(db *sqlx.DB, bus TxBus) BookingSagaRepo {
+	return BookingSagaRepo{
+		db:  db,
+		bus: bus,
+	}
+}
+
+func (r BookingSagaRepo) Get(ctx context.Context, bookingID string) (entity.BookingSaga, error) {
+	row := r.db.QueryRowxContext(ctx, `SELECT booking_id, show_id, status, failure_reason, created_at, updated_at
+		FROM booking_sagas WHERE booking_id = $1`, bookingID)
+
+	var s entity.BookingSaga
+	err := row.Scan(&s.BookingID, &s.ShowID, &s.Status, &s.FailureReason, &s.CreatedAt, &s.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.BookingSaga{}, bookingSagaNotFoundError{bookingID: bookingID}
+	}
+	if err != nil {
+		return entity.BookingSaga{}, fmt.Errorf("scanning row: %w", err)
+	}
+
+	return s, nil
+}
+
+// Confirm moves a pending saga to confirmed. Sagas in any other state are left unchanged.
+func (r BookingSagaRepo) Confirm(ctx context.Context, bookingID string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE booking_sagas
+		SET status = $2, updated_at = now()
+		WHERE booking_id = $1 AND status = $3`,
+		bookingID, entity.BookingSagaConfirmed, entity.BookingSagaPending)
+	return err
+}
+
+// Fail compensates a pending saga: it marks the saga failed, releases the
+// booked seats and publishes BookingFailed in a single transaction.
+func (r BookingSagaRepo) Fail(ctx context.Context, bookingID, reason string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	if err := r.fail(ctx, tx, bookingID, reason); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r BookingSagaRepo) fail(ctx context.Context, tx *sql.Tx, bookingID, reason string) error {
+	res, err := tx.ExecContext(ctx, `UPDATE booking_sagas
+		SET status = $2, failure_reason = $3, updated_at = now()
+		WHERE booking_id = $1 AND status = $4`,
+		bookingID, entity.BookingSagaFailed, reason, entity.BookingSagaPending)
+	if err != nil {
+		return fmt.Errorf("updating booking saga: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting rows affected: %w", err)
+	}
+	if n == 0 {
+		// Already compensated, or confirmed before the failure was reported.
+		return nil
+	}
+
+	row := tx.QueryRowContext(ctx, `UPDATE bookings b
+		SET canceled_at = coalesce(b.canceled_at, now())
+		FROM (SELECT canceled_at IS NOT NULL AS canceled FROM bookings WHERE booking_id = $1 FOR UPDATE) prev
+		WHERE b.booking_id = $1
+		RETURNING b.show_id, b.number_of_tickets, b.customer_email, prev.canceled`, bookingID)
+
+	booking := entity.Booking{BookingID: bookingID}
+	var alreadyCanceled bool
+	if err := row.Scan(&booking.ShowID, &booking.NumberOfTickets, &booking.CustomerEmail, &alreadyCanceled); err != nil {
+		return fmt.Errorf("canceling booking: %w", err)
+	}
+
+	// A booking the customer canceled already gave its seats back.
+	if !alreadyCanceled {
+		if err := releaseBookedTickets(ctx, tx, booking); err != nil {
+			return err
+		}
+	}
+
+	e := event.NewBookingFailed(bookingID, booking, reason)
+
+	if err := r.bus.Publish(ctx, tx, e); err != nil {
+		return fmt.Errorf("publishing event in transaction: %w", err)
+	}
+
+	return nil
+}
@@ -7,20 +7,31 @@ import (
 	"fmt"
 
 	"tickets/entity"
-	"tickets/message"
 	"tickets/message/event"
 
+	watermillSQL "github.com/ThreeDotsLabs/watermill-sql/v2/pkg/sql"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 )
 
+// TxBus publishes events and sends commands as part of a database
+// transaction, so they are only sent if the transaction commits.
+type TxBus interface {
+	Publish(ctx context.Context, tx watermillSQL.ContextExecutor, events ...any) error
+	Send(ctx context.Context, tx watermillSQL.ContextExecutor, cmd any) error
+}
+
 type notEnoughTicketsError struct {
+	category         string
 	ticketsAvailable uint
 	ticketsRequested uint
 }
 
 func (e notEnoughTicketsError) Error() string {
+	if e.category != "" {
+		return fmt.Sprintf("not enough %s tickets: tickets available %d, tickets requested %d", e.category, e.ticketsAvailable, e.ticketsRequested)
+	}
 	return fmt.Sprintf("not enough tickets: tickets available %d, tickets requested %d", e.ticketsAvailable, e.ticketsRequested)
 }
 
@@ -28,35 +39,70 @@ func (e notEnoughTicketsError) NotEnoughTickets() bool {
 	return true
 }
 
-func CreateBookingsTable(ctx context.Context, db *sqlx.DB) error {
-	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS bookings (
-		booking_id UUID PRIMARY KEY,
-		show_id UUID NOT NULL,
-		number_of_tickets INTEGER NOT NULL,
-		customer_email VARCHAR(255) NOT NULL
-	);`)
-	return err
+type ticketCategoryNotFoundError struct {
+	showID   string
+	category string
+}
+
+func (e ticketCategoryNotFoundError) Error() string {
+	return fmt.Sprintf("show %s has no ticket category %s", e.showID, e.category)
+}
+
+func (e ticketCategoryNotFoundError) InvalidCategory() bool {
+	return true
+}
+
+type bookingNotFoundError struct {
+	bookingID string
+}
+
+func (e bookingNotFoundError) Error() string {
+	return fmt.Sprintf("booking %s not found", e.bookingID)
+}
+
+func (e bookingNotFoundError) NotFound() bool {
+	return true
+}
+
+type bookingAlreadyCanceledError struct {
+	bookingID string
+}
+
+func (e bookingAlreadyCanceledError) Error() string {
+	return fmt.Sprintf("booking %s already canceled", e.bookingID)
+}
+
+func (e bookingAlreadyCanceledError) AlreadyCanceled() bool {
+	return true
 }
 
 type BookingRepo struct {
-	db *sqlx.DB
+	db  *sqlx.DB
+	bus TxBus
 }
 
-func NewBookingRepo(db *sqlx.DB) BookingRepo {
+func NewBookingRepo(db *sqlx.DB, bus TxBus) BookingRepo {
 	return BookingRepo{
-		db: db,
+		db:  db,
+		bus: bus,
 	}
 }
 
-func (r BookingRepo) Add(ctx context.Context, totalTickets uint, booking entity.Booking) error {
-	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{
-		Isolation: sql.LevelSerializable,
+// Add stores the booking if the show has enough tickets left. Transactions
+// aborted by a deadlock are retried.
+func (r BookingRepo) Add(ctx context.Context, booking entity.Booking) error {
+	return retryTxConflicts(ctx, func() error {
+		return r.tryAdd(ctx, booking)
 	})
+}
+
+func (r BookingRepo) tryAdd(ctx context.Context, booking entity.Booking) error {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("beginning transaction: %w", err)
 	}
 
-	if err := add(ctx, tx, totalTickets, booking); err != nil {
+	if err := r.add(ctx, tx, booking); err != nil {
 		return errors.Join(err, tx.Rollback())
 	}
 
@@ -67,22 +113,41 @@ func (r BookingRepo) Add(ctx context.Context, totalTickets uint, booking entity.
 	return nil
 }
 
-func add(ctx context.Context, tx *sql.Tx, totalTickets uint, booking entity.Booking) error {
-	row := tx.QueryRowContext(ctx, `SELECT coalesce(SUM(number_of_tickets), 0)
-		FROM bookings WHERE show_id = $1`, booking.ShowID)
-	var ticketsBooked uint
-	if err := row.Scan(&ticketsBooked); err != nil {
-		return fmt.Errorf("counting tickets booked: %w", err)
+func (r BookingRepo) add(ctx context.Context, tx *sql.Tx, booking entity.Booking) error {
+	if err := reserveTickets(ctx, tx, booking.ShowID, booking.NumberOfTickets); err != nil {
+		return err
 	}
 
-	ticketsAvailable := totalTickets - ticketsBooked
-	if booking.NumberOfTickets > ticketsAvailable {
-		return notEnoughTicketsError{
-			ticketsAvailable: ticketsAvailable,
-			ticketsRequested: booking.NumberOfTickets,
+	if len(booking.Items) > 0 {
+		items, err := priceItems(ctx, tx, booking.ShowID, booking.Items)
+		if err != nil {
+			return err
 		}
+		booking.Items = items
 	}
 
+	return insertBooking(ctx, tx, r.bus, booking)
+}
+
+// priceItems reserves each item's tickets in its category and sets the
+// item's unit price from the category.
+func priceItems(ctx context.Context, tx *sql.Tx, showID string, items []entity.BookingItem) ([]entity.BookingItem, error) {
+	priced := make([]entity.BookingItem, 0, len(items))
+	for _, item := range items {
+		price, err := reserveCategoryTickets(ctx, tx, showID, item)
+		if err != nil {
+			return nil, err
+		}
+
+		item.UnitPrice = price
+		priced = append(priced, item)
+	}
+
+	return priced, nil
+}
+
+// insertBooking stores the booking with a pending saga and publishes BookingMade.
+func insertBooking(ctx context.Context, tx *sql.Tx, bus TxBus, booking entity.Booking) error {
 	_, err := tx.ExecContext(ctx, `INSERT INTO bookings
 		(booking_id, show_id, number_of_tickets, customer_email)
 		VALUES ($1, $2, $3, $4);`,
@@ -91,9 +156,209 @@ func add(ctx context.Context, tx *sql.Tx, totalTickets uint, booking entity.Book
 		return fmt.Errorf("inserting booking: %w", err)
 	}
 
+	if len(booking.Items) > 0 {
+		total, err := insertBookingItems(ctx, tx, booking)
+		if err != nil {
+			return err
+		}
+		booking.TotalPrice = &total
+	}
+
+	if booking.PromoCode != "" {
+		discount, total, err := redeemPromoCode(ctx, tx, booking)
+		if err != nil {
+			return err
+		}
+		booking.Discount = &discount
+		booking.TotalPrice = &total
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO booking_sagas
+		(booking_id, show_id, status)
+		VALUES ($1, $2, $3);`,
+		booking.BookingID, booking.ShowID, entity.BookingSagaPending)
+	if err != nil {
+		return fmt.Errorf("inserting booking saga: %w", err)
+	}
+
 	e := event.NewBookingMade(uuid.NewString(), booking)
 
-	if err := message.PublishInTx(ctx, e, tx); err != nil {
+	if err := bus.Publish(ctx, tx, e); err != nil {
+		return fmt.Errorf("publishing event in transaction: %w", err)
+	}
+
+	return nil
+}
+
+// insertBookingItems stores the booking's items and returns their total price.
+func insertBookingItems(ctx context.Context, tx *sql.Tx, booking entity.Booking) (entity.Money, error) {
+	for _, item := range booking.Items {
+		_, err := tx.ExecContext(ctx, `INSERT INTO booking_items
+			(booking_id, category, quantity, unit_price_amount, unit_price_currency)
+			VALUES ($1, $2, $3, $4, $5);`,
+			booking.BookingID, item.Category, item.Quantity, item.UnitPrice.Amount, item.UnitPrice.Currency)
+		if err != nil {
+			return entity.Money{}, fmt.Errorf("inserting booking item %s: %w", item.Category, err)
+		}
+	}
+
+	// Categories of a show share one currency.
+	total := entity.Money{Currency: booking.Items[0].UnitPrice.Currency}
+	row := tx.QueryRowContext(ctx, `UPDATE bookings
+		SET total_price_amount = (SELECT SUM(quantity * unit_price_amount) FROM booking_items WHERE booking_id = $1),
+			total_price_currency = $2
+		WHERE booking_id = $1
+		RETURNING total_price_amount::text`, booking.BookingID, total.Currency)
+	if err := row.Scan(&total.Amount); err != nil {
+		return entity.Money{}, fmt.Errorf("updating booking total price: %w", err)
+	}
+
+	return total, nil
+}
+
+func (r BookingRepo) Get(ctx context.Context, bookingID string) (entity.Booking, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT show_id, number_of_tickets, customer_email,
+		total_price_amount::text, total_price_currency, discount_amount::text
+		FROM bookings WHERE booking_id = $1`, bookingID)
+
+	booking := entity.Booking{BookingID: bookingID}
+	var totalAmount, totalCurrency, discountAmount *string
+	err := row.Scan(&booking.ShowID, &booking.NumberOfTickets, &booking.CustomerEmail,
+		&totalAmount, &totalCurrency, &discountAmount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Booking{}, bookingNotFoundError{bookingID: bookingID}
+	}
+	if err != nil {
+		return entity.Booking{}, fmt.Errorf("scanning row: %w", err)
+	}
+
+	if totalAmount != nil && totalCurrency != nil {
+		booking.TotalPrice = &entity.Money{Amount: *totalAmount, Currency: *totalCurrency}
+		if discountAmount != nil {
+			booking.Discount = &entity.Money{Amount: *discountAmount, Currency: *totalCurrency}
+		}
+	}
+
+	return booking, nil
+}
+
+// ReceiptPrice returns the price of the ticket's receipt. Each ticket of the
+// booking gets its share of the booking's total price, except the last one,
+// which gets what's left of it, so the receipts add up to the total. The price
+// is stored, so a retried receipt gets the same one.
+func (r BookingRepo) ReceiptPrice(ctx context.Context, bookingID, ticketID string, share entity.Money) (entity.Money, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.Money{}, fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	price, err := r.receiptPrice(ctx, tx, bookingID, ticketID, share)
+	if err != nil {
+		return entity.Money{}, errors.Join(err, tx.Rollback())
+	}
+
+	if err = tx.Commit(); err != nil {
+		return entity.Money{}, fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return price, nil
+}
+
+func (r BookingRepo) receiptPrice(ctx context.Context, tx *sql.Tx, bookingID, ticketID string, share entity.Money) (entity.Money, error) {
+	// Locking the booking keeps two of its tickets from both taking the rest.
+	var numberOfTickets uint
+	var totalAmount *string
+	err := tx.QueryRowContext(ctx, `SELECT number_of_tickets, total_price_amount::text
+		FROM bookings WHERE booking_id = $1 FOR UPDATE`, bookingID).Scan(&numberOfTickets, &totalAmount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Money{}, bookingNotFoundError{bookingID: bookingID}
+	}
+	if err != nil {
+		return entity.Money{}, fmt.Errorf("locking booking: %w", err)
+	}
+
+	if totalAmount == nil {
+		return share, nil
+	}
+
+	var amount string
+	err = tx.QueryRowContext(ctx, `SELECT amount::text FROM receipt_prices WHERE ticket_id = $1`, ticketID).Scan(&amount)
+	if err == nil {
+		return entity.Money{Amount: amount, Currency: share.Currency}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return entity.Money{}, fmt.Errorf("getting receipt price: %w", err)
+	}
+
+	var priced uint
+	var rest string
+	err = tx.QueryRowContext(ctx, `SELECT count(*), ($2::numeric - coalesce(SUM(amount), 0))::text
+		FROM receipt_prices WHERE booking_id = $1`, bookingID, *totalAmount).Scan(&priced, &rest)
+	if err != nil {
+		return entity.Money{}, fmt.Errorf("summing receipt prices: %w", err)
+	}
+
+	amount = share.Amount
+	if priced+1 == numberOfTickets {
+		amount = rest
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO receipt_prices (ticket_id, booking_id, amount)
+		VALUES ($1, $2, $3)`, ticketID, bookingID, amount)
+	if err != nil {
+		return entity.Money{}, fmt.Errorf("inserting receipt price: %w", err)
+	}
+
+	return entity.Money{Amount: amount, Currency: share.Currency}, nil
+}
+
+func (r BookingRepo) Cancel(ctx context.Context, bookingID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	if err := r.cancel(ctx, tx, bookingID); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r BookingRepo) cancel(ctx context.Context, tx *sql.Tx, bookingID string) error {
+	row := tx.QueryRowContext(ctx, `SELECT show_id, number_of_tickets, customer_email, canceled_at IS NOT NULL
+		FROM bookings WHERE booking_id = $1 FOR UPDATE`, bookingID)
+
+	booking := entity.Booking{BookingID: bookingID}
+	var canceled bool
+	err := row.Scan(&booking.ShowID, &booking.NumberOfTickets, &booking.CustomerEmail, &canceled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return bookingNotFoundError{bookingID: bookingID}
+	}
+	if err != nil {
+		return fmt.Errorf("getting booking: %w", err)
+	}
+
+	if canceled {
+		return bookingAlreadyCanceledError{bookingID: bookingID}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE bookings SET canceled_at = now() WHERE booking_id = $1`, bookingID)
+	if err != nil {
+		return fmt.Errorf("canceling booking: %w", err)
+	}
+
+	if err := releaseBookedTickets(ctx, tx, booking); err != nil {
+		return err
+	}
+
+	e := event.NewBookingCanceled(uuid.NewString(), booking)
+
+	if err := r.bus.Publish(ctx, tx, e); err != nil {
 		return fmt.Errorf("publishing event in transaction: %w", err)
 	}
 
@@ -0,0 +1,263 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"tickets/entity"
+	"tickets/message"
+	"tickets/message/event"
+	"tickets/postgres"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBookingRepo_Add_ticketCategories(t *testing.T) {
+	ctx := context.Background()
+	showRepo := postgres.NewShowRepo(db)
+	r := postgres.NewBookingRepo(db, newOutboxTxBus(t))
+
+	show := entity.Show{
+		ShowID:          uuid.NewString(),
+		DeadNationID:    uuid.NewString(),
+		NumberOfTickets: 12,
+		StartTime:       time.Now().UTC().Truncate(time.Second),
+		Title:           "Test show",
+		Venue:           "Test venue",
+		Categories: []entity.TicketCategory{
+			{Name: "standing", Capacity: 10, Price: entity.Money{Amount: "25.00", Currency: "EUR"}},
+			{Name: "vip", Capacity: 2, Price: entity.Money{Amount: "100.50", Currency: "EUR"}},
+		},
+	}
+	require.NoError(t, showRepo.Add(ctx, show))
+
+	booking := entity.Booking{
+		BookingID:       uuid.NewString(),
+		ShowID:          show.ShowID,
+		NumberOfTickets: 4,
+		CustomerEmail:   "test@example.com",
+		Items: []entity.BookingItem{
+			{Category: "standing", Quantity: 3},
+			{Category: "vip", Quantity: 1},
+		},
+	}
+	require.NoError(t, r.Add(ctx, booking))
+
+	var total string
+	err := db.GetContext(ctx, &total, `SELECT total_price_amount::text FROM bookings WHERE booking_id = $1`, booking.BookingID)
+	require.NoError(t, err)
+	assert.Equal(t, "175.50", total)
+
+	availability, err := showRepo.GetAvailability(ctx, show.ShowID)
+	require.NoError(t, err)
+	assert.Equal(t, uint(8), availability.TicketsAvailable)
+	require.Len(t, availability.CategoriesAvailable, 2)
+	assert.Equal(t, "standing", availability.CategoriesAvailable[0].Name)
+	assert.Equal(t, uint(7), availability.CategoriesAvailable[0].TicketsAvailable)
+	assert.Equal(t, "vip", availability.CategoriesAvailable[1].Name)
+	assert.Equal(t, uint(1), availability.CategoriesAvailable[1].TicketsAvailable)
+
+	tooMany := booking
+	tooMany.BookingID = uuid.NewString()
+	tooMany.NumberOfTickets = 2
+	tooMany.Items = []entity.BookingItem{{Category: "vip", Quantity: 2}}
+	err = r.Add(ctx, tooMany)
+	var notEnoughTicketsErr interface{ NotEnoughTickets() bool }
+	assert.ErrorAs(t, err, &notEnoughTicketsErr)
+
+	unknown := booking
+	unknown.BookingID = uuid.NewString()
+	unknown.NumberOfTickets = 1
+	unknown.Items = []entity.BookingItem{{Category: "balcony", Quantity: 1}}
+	err = r.Add(ctx, unknown)
+	var invalidCategoryErr interface{ InvalidCategory() bool }
+	assert.ErrorAs(t, err, &invalidCategoryErr)
+}
+
+func TestBookingRepo_Add_concurrently(t *testing.T) {
+	ctx := context.Background()
+	showRepo := postgres.NewShowRepo(db)
+	r := postgres.NewBookingRepo(db, newOutboxTxBus(t))
+
+	// Stay below Postgres' connection limit; the rest of the bookings wait
+	// for a connection, so they still overlap.
+	db.SetMaxOpenConns(20)
+	t.Cleanup(func() { db.SetMaxOpenConns(0) })
+
+	show := entity.Show{
+		ShowID:          uuid.NewString(),
+		DeadNationID:    uuid.NewString(),
+		NumberOfTickets: 50,
+		StartTime:       time.Now().UTC().Truncate(time.Second),
+		Title:           "Test show",
+		Venue:           "Test venue",
+	}
+	require.NoError(t, showRepo.Add(ctx, show))
+
+	const bookings = 300
+
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+		sold uint
+		errs []error
+	)
+	for i := 0; i < bookings; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := r.Add(ctx, entity.Booking{
+				BookingID:       uuid.NewString(),
+				ShowID:          show.ShowID,
+				NumberOfTickets: 1,
+				CustomerEmail:   "test@example.com",
+			})
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			sold++
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, show.NumberOfTickets, sold)
+	for _, err := range errs {
+		var notEnoughTicketsErr interface{ NotEnoughTickets() bool }
+		assert.ErrorAs(t, err, &notEnoughTicketsErr)
+	}
+
+	var booked uint
+	err := db.GetContext(ctx, &booked, `SELECT SUM(number_of_tickets) FROM bookings WHERE show_id = $1`, show.ShowID)
+	require.NoError(t, err)
+	assert.Equal(t, show.NumberOfTickets, booked, "show should not be oversold")
+}
+
+// BenchmarkBookingRepo_Add compares booking throughput of the inventory
+// counter with checking availability by summing the show's bookings in a
+// serializable transaction, as bookings were made before the counter.
+func BenchmarkBookingRepo_Add(b *testing.B) {
+	ctx := context.Background()
+	showRepo := postgres.NewShowRepo(db)
+	txBus := newOutboxTxBus(b)
+	r := postgres.NewBookingRepo(db, txBus)
+
+	db.SetMaxOpenConns(20)
+	b.Cleanup(func() { db.SetMaxOpenConns(0) })
+
+	newShow := func(b *testing.B) entity.Show {
+		show := entity.Show{
+			ShowID:          uuid.NewString(),
+			DeadNationID:    uuid.NewString(),
+			NumberOfTickets: 1_000_000_000,
+			StartTime:       time.Now().UTC().Truncate(time.Second),
+			Title:           "Benchmark show",
+			Venue:           "Benchmark venue",
+		}
+		require.NoError(b, showRepo.Add(ctx, show))
+		return show
+	}
+
+	newBooking := func(showID string) entity.Booking {
+		return entity.Booking{
+			BookingID:       uuid.NewString(),
+			ShowID:          showID,
+			NumberOfTickets: 2,
+			CustomerEmail:   "test@example.com",
+		}
+	}
+
+	b.Run("inventory counter", func(b *testing.B) {
+		show := newShow(b)
+		b.ResetTimer()
+
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if err := r.Add(ctx, newBooking(show.ShowID)); err != nil {
+					b.Error(err)
+				}
+			}
+		})
+	})
+
+	b.Run("sum over bookings", func(b *testing.B) {
+		show := newShow(b)
+		b.ResetTimer()
+
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if err := addBookingSummingBookings(ctx, txBus, show, newBooking(show.ShowID)); err != nil {
+					b.Error(err)
+				}
+			}
+		})
+	})
+}
+
+// summingBookingsMaxAttempts bounds the retries of serialization failures,
+// which are frequent with many concurrent bookings of a show.
+const summingBookingsMaxAttempts = 100
+
+func addBookingSummingBookings(ctx context.Context, txBus message.TxBus, show entity.Show, booking entity.Booking) error {
+	var err error
+	for attempt := 0; attempt < summingBookingsMaxAttempts; attempt++ {
+		err = tryAddBookingSummingBookings(ctx, txBus, show, booking)
+
+		var pqErr *pq.Error
+		if !errors.As(err, &pqErr) || (pqErr.Code != "40001" && pqErr.Code != "40P01") {
+			return err
+		}
+	}
+
+	return fmt.Errorf("giving up after %d attempts: %w", summingBookingsMaxAttempts, err)
+}
+
+func tryAddBookingSummingBookings(ctx context.Context, txBus message.TxBus, show entity.Show, booking entity.Booking) error {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var ticketsTaken uint
+	err = tx.QueryRowContext(ctx, `SELECT coalesce(SUM(number_of_tickets), 0) FROM bookings
+		WHERE show_id = $1 AND canceled_at IS NULL`, booking.ShowID).Scan(&ticketsTaken)
+	if err != nil {
+		return err
+	}
+	if ticketsTaken+booking.NumberOfTickets > show.NumberOfTickets {
+		return fmt.Errorf("not enough tickets")
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO bookings (booking_id, show_id, number_of_tickets, customer_email)
+		VALUES ($1, $2, $3, $4)`, booking.BookingID, booking.ShowID, booking.NumberOfTickets, booking.CustomerEmail)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO booking_sagas (booking_id, show_id, status)
+		VALUES ($1, $2, $3)`, booking.BookingID, booking.ShowID, entity.BookingSagaPending)
+	if err != nil {
+		return err
+	}
+
+	if err := txBus.Publish(ctx, tx, event.NewBookingMade(uuid.NewString(), booking)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
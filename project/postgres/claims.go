@@ -0,0 +1,34 @@
+package postgres
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	claimPollInitialInterval = 50 * time.Millisecond
+	claimPollMaxInterval     = time.Second
+)
+
+// waitForClaim calls claim until it claims the key or finds the work done.
+// Another delivery's claim is waited out rather than failed on, so a
+// redelivered message doesn't use up its retries: the claim is completed or
+// released, or it expires and is taken over, so the wait is bounded by the
+// claim's TTL.
+func waitForClaim(ctx context.Context, claim func() (claimed, done bool, err error)) (claimed, done bool, err error) {
+	interval := claimPollInitialInterval
+	for {
+		claimed, done, err := claim()
+		if err != nil || claimed || done {
+			return claimed, done, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, false, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		interval = min(2*interval, claimPollMaxInterval)
+	}
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"tickets/entity"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+type EventStoreRepo struct {
+	db *sqlx.DB
+}
+
+func NewEventStoreRepo(db *sqlx.DB) EventStoreRepo {
+	return EventStoreRepo{
+		db: db,
+	}
+}
+
+func (r EventStoreRepo) Append(ctx context.Context, e entity.StoredEvent) error {
+	metadata, err := json.Marshal(e.Metadata)
+	if err != nil {
+		return fmt.Errorf("marshaling metadata: %w", err)
+	}
+
+	_, err = r.db.ExecContext(ctx, `INSERT INTO events
+		(event_id, event_name, payload, metadata, correlation_id, published_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (event_id) DO NOTHING;`,
+		e.EventID, e.EventName, string(e.Payload), string(metadata), e.CorrelationID, e.PublishedAt)
+	return err
+}
+
+func (r EventStoreRepo) List(ctx context.Context, filter entity.StoredEventFilter) ([]entity.StoredEvent, error) {
+	var conditions []string
+	var args []any
+	if filter.EventName != "" {
+		args = append(args, filter.EventName)
+		conditions = append(conditions, fmt.Sprintf("event_name = $%d", len(args)))
+	}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		conditions = append(conditions, fmt.Sprintf("published_at >= $%d", len(args)))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		conditions = append(conditions, fmt.Sprintf("published_at < $%d", len(args)))
+	}
+
+	query := `SELECT sequence, event_id, event_name, payload, metadata, correlation_id, published_at, stored_at
+		FROM events`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY published_at, sequence"
+
+	rows, err := r.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying db: %w", err)
+	}
+	defer rows.Close()
+
+	var events []entity.StoredEvent
+	for rows.Next() {
+		var e entity.StoredEvent
+		var metadata []byte
+		if err := rows.Scan(&e.Sequence, &e.EventID, &e.EventName, &e.Payload, &metadata,
+			&e.CorrelationID, &e.PublishedAt, &e.StoredAt); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+
+		if err := json.Unmarshal(metadata, &e.Metadata); err != nil {
+			return nil, fmt.Errorf("unmarshaling metadata of event %s: %w", e.EventID, err)
+		}
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
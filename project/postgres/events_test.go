@@ -0,0 +1,47 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"tickets/entity"
+	"tickets/postgres"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventStoreRepo_Append(t *testing.T) {
+	ctx := context.Background()
+	r := postgres.NewEventStoreRepo(db)
+
+	eventName := "TestEvent" + uuid.NewString()
+	publishedAt := time.Now().UTC().Truncate(time.Millisecond)
+	e := entity.StoredEvent{
+		EventID:       uuid.NewString(),
+		EventName:     eventName,
+		Payload:       []byte(`{"ticket_id": "123"}`),
+		Metadata:      map[string]string{"correlation_id": "test-correlation-id"},
+		CorrelationID: "test-correlation-id",
+		PublishedAt:   publishedAt,
+	}
+	require.NoError(t, r.Append(ctx, e))
+	require.NoError(t, r.Append(ctx, e))
+
+	from := publishedAt.Add(-time.Minute)
+	events, err := r.List(ctx, entity.StoredEventFilter{EventName: eventName, From: &from})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, e.EventID, events[0].EventID)
+	assert.JSONEq(t, `{"ticket_id": "123"}`, string(events[0].Payload))
+	assert.Equal(t, e.Metadata, events[0].Metadata)
+	assert.Equal(t, "test-correlation-id", events[0].CorrelationID)
+	assert.True(t, publishedAt.Equal(events[0].PublishedAt))
+
+	to := publishedAt.Add(-time.Second)
+	events, err = r.List(ctx, entity.StoredEventFilter{EventName: eventName, To: &to})
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
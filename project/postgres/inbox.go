@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+type InboxRepo struct {
+	db *sqlx.DB
+}
+
+func NewInboxRepo(db *sqlx.DB) InboxRepo {
+	return InboxRepo{
+		db: db,
+	}
+}
+
+// inboxClaimTTL is how long a delivery owns a message. A claim left behind
+// by a crashed consumer is taken over once it expires.
+const inboxClaimTTL = time.Minute
+
+// ProcessOnce calls handle unless the handler has already processed the
+// message. It claims the message in its own short statement, runs handle
+// without holding a connection, and then marks the message processed. A
+// delivery that finds the message claimed by another one waits until that
+// delivery is done, or its claim expires and can be taken over.
+//
+// If marking the message processed fails, the claim expires and handle runs
+// again on redelivery, so handlers must still tolerate being called twice.
+func (r InboxRepo) ProcessOnce(ctx context.Context, handlerName, messageKey string, handle func() error) (bool, error) {
+	_, processed, err := waitForClaim(ctx, func() (bool, bool, error) {
+		return r.claim(ctx, handlerName, messageKey)
+	})
+	if err != nil {
+		return false, err
+	}
+	if processed {
+		return true, nil
+	}
+
+	if err := handle(); err != nil {
+		return false, errors.Join(err, r.release(ctx, handlerName, messageKey))
+	}
+
+	_, err = r.db.ExecContext(ctx, `UPDATE processed_messages
+		SET completed_at = now(), processed_at = now()
+		WHERE handler_name = $1 AND message_key = $2`, handlerName, messageKey)
+	if err != nil {
+		return false, fmt.Errorf("marking message processed: %w", err)
+	}
+
+	return false, nil
+}
+
+// claim takes the message for this delivery, unless it's processed or
+// claimed by another delivery whose claim hasn't expired.
+func (r InboxRepo) claim(ctx context.Context, handlerName, messageKey string) (claimed, processed bool, err error) {
+	res, err := r.db.ExecContext(ctx, `INSERT INTO processed_messages
+		(handler_name, message_key, claimed_until)
+		VALUES ($1, $2, now() + $3 * interval '1 millisecond')
+		ON CONFLICT (handler_name, message_key) DO UPDATE
+		SET claimed_until = EXCLUDED.claimed_until
+		WHERE processed_messages.completed_at IS NULL AND processed_messages.claimed_until <= now()`,
+		handlerName, messageKey, inboxClaimTTL.Milliseconds())
+	if err != nil {
+		return false, false, fmt.Errorf("claiming message: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, false, fmt.Errorf("getting rows affected: %w", err)
+	}
+	if n == 1 {
+		return true, false, nil
+	}
+
+	err = r.db.GetContext(ctx, &processed, `SELECT completed_at IS NOT NULL FROM processed_messages
+		WHERE handler_name = $1 AND message_key = $2`, handlerName, messageKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Released by a failed delivery in the meantime.
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("getting processed message: %w", err)
+	}
+
+	return false, processed, nil
+}
+
+// release drops the claim of a failed delivery, so the retry doesn't wait for
+// it to expire.
+func (r InboxRepo) release(ctx context.Context, handlerName, messageKey string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM processed_messages
+		WHERE handler_name = $1 AND message_key = $2 AND completed_at IS NULL`, handlerName, messageKey)
+	if err != nil {
+		return fmt.Errorf("releasing message claim: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteProcessedBefore deletes messages processed before the time, along with
+// claims abandoned by deliveries that never came back. Live claims are kept.
+func (r InboxRepo) DeleteProcessedBefore(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM processed_messages
+		WHERE completed_at < $1 OR (completed_at IS NULL AND claimed_until < $1)`, before)
+	if err != nil {
+		return 0, fmt.Errorf("executing delete query: %w", err)
+	}
+
+	return res.RowsAffected()
+}
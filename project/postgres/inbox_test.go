@@ -0,0 +1,104 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tickets/postgres"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInboxRepo_ProcessOnce(t *testing.T) {
+	ctx := context.Background()
+	r := postgres.NewInboxRepo(db)
+	messageKey := "TicketBookingConfirmed:" + uuid.NewString()
+
+	var calls int
+	handle := func() error {
+		calls++
+		return nil
+	}
+
+	duplicate, err := r.ProcessOnce(ctx, "append-to-tracker-confirmed", messageKey, handle)
+	require.NoError(t, err)
+	assert.False(t, duplicate)
+
+	duplicate, err = r.ProcessOnce(ctx, "append-to-tracker-confirmed", messageKey, handle)
+	require.NoError(t, err)
+	assert.True(t, duplicate)
+
+	duplicate, err = r.ProcessOnce(ctx, "issue-receipt", messageKey, handle)
+	require.NoError(t, err)
+	assert.False(t, duplicate)
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestInboxRepo_ProcessOnce_HandlerFails(t *testing.T) {
+	ctx := context.Background()
+	r := postgres.NewInboxRepo(db)
+	messageKey := "TicketBookingConfirmed:" + uuid.NewString()
+
+	_, err := r.ProcessOnce(ctx, "print-ticket", messageKey, func() error {
+		return errors.New("failed")
+	})
+	require.Error(t, err)
+
+	var called bool
+	duplicate, err := r.ProcessOnce(ctx, "print-ticket", messageKey, func() error {
+		called = true
+		return nil
+	})
+	require.NoError(t, err)
+	assert.False(t, duplicate)
+	assert.True(t, called)
+}
+
+func TestInboxRepo_ProcessOnce_InProgress(t *testing.T) {
+	ctx := context.Background()
+	r := postgres.NewInboxRepo(db)
+	messageKey := "TicketBookingConfirmed:" + uuid.NewString()
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := r.ProcessOnce(ctx, "print-ticket", messageKey, func() error {
+			close(started)
+			<-finish
+			return nil
+		})
+		firstErr <- err
+	}()
+	<-started
+
+	type result struct {
+		duplicate bool
+		err       error
+	}
+	second := make(chan result, 1)
+	go func() {
+		duplicate, err := r.ProcessOnce(ctx, "print-ticket", messageKey, func() error {
+			return errors.New("should not be called while the first delivery runs")
+		})
+		second <- result{duplicate: duplicate, err: err}
+	}()
+
+	select {
+	case <-second:
+		t.Fatal("second delivery should wait for the first one")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	close(finish)
+	require.NoError(t, <-firstErr)
+
+	res := <-second
+	require.NoError(t, res.err)
+	assert.True(t, res.duplicate, "second delivery should be skipped once the first one is done")
+}
@@ -0,0 +1,159 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"tickets/entity"
+)
+
+// Each show keeps the number of tickets neither booked nor held in its
+// show_inventory row, and each ticket category in its own row. Reserving
+// tickets decrements the row only if enough are left, so concurrent bookings
+// queue on the row lock instead of scanning all bookings of the show.
+//
+// Rows are always locked in the same order, the show's first and then its
+// categories, so transactions touching both don't deadlock.
+
+// reserveTickets takes the tickets out of the show's inventory, or fails with
+// notEnoughTicketsError if it has fewer left.
+func reserveTickets(ctx context.Context, tx *sql.Tx, showID string, tickets uint) error {
+	reserved, err := decrementInventory(ctx, tx, showID, tickets)
+	if err != nil || reserved {
+		return err
+	}
+
+	// Holds past their expiry keep their tickets until they are released, so
+	// release them before telling the customer there aren't enough. The failed
+	// decrement didn't lock the show's row, so lock it before the holds.
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM show_inventory WHERE show_id = $1 FOR UPDATE`, showID); err != nil {
+		return fmt.Errorf("locking show inventory: %w", err)
+	}
+	if _, err := releaseExpiredHolds(ctx, tx, time.Now(), showID); err != nil {
+		return err
+	}
+
+	reserved, err = decrementInventory(ctx, tx, showID, tickets)
+	if err != nil || reserved {
+		return err
+	}
+
+	var ticketsAvailable uint
+	row := tx.QueryRowContext(ctx, `SELECT tickets_available FROM show_inventory WHERE show_id = $1`, showID)
+	err = row.Scan(&ticketsAvailable)
+	if errors.Is(err, sql.ErrNoRows) {
+		return showNotFoundError{showID: showID}
+	}
+	if err != nil {
+		return fmt.Errorf("getting show inventory: %w", err)
+	}
+
+	return notEnoughTicketsError{
+		ticketsAvailable: ticketsAvailable,
+		ticketsRequested: tickets,
+	}
+}
+
+func decrementInventory(ctx context.Context, tx *sql.Tx, showID string, tickets uint) (bool, error) {
+	res, err := tx.ExecContext(ctx, `UPDATE show_inventory
+		SET tickets_available = tickets_available - $2
+		WHERE show_id = $1 AND tickets_available >= $2`, showID, tickets)
+	if err != nil {
+		return false, fmt.Errorf("reserving tickets: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("getting rows affected: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+// reserveCategoryTickets takes the item's tickets out of its category and
+// returns the category's price.
+func reserveCategoryTickets(ctx context.Context, tx *sql.Tx, showID string, item entity.BookingItem) (entity.Money, error) {
+	var price entity.Money
+	row := tx.QueryRowContext(ctx, `UPDATE show_ticket_categories
+		SET tickets_available = tickets_available - $3
+		WHERE show_id = $1 AND name = $2 AND tickets_available >= $3
+		RETURNING price_amount::text, price_currency`, showID, item.Category, item.Quantity)
+	err := row.Scan(&price.Amount, &price.Currency)
+	if err == nil {
+		return price, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return entity.Money{}, fmt.Errorf("reserving %s tickets: %w", item.Category, err)
+	}
+
+	var ticketsAvailable uint
+	row = tx.QueryRowContext(ctx, `SELECT tickets_available FROM show_ticket_categories
+		WHERE show_id = $1 AND name = $2`, showID, item.Category)
+	err = row.Scan(&ticketsAvailable)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Money{}, ticketCategoryNotFoundError{showID: showID, category: item.Category}
+	}
+	if err != nil {
+		return entity.Money{}, fmt.Errorf("getting ticket category %s: %w", item.Category, err)
+	}
+
+	return entity.Money{}, notEnoughTicketsError{
+		category:         item.Category,
+		ticketsAvailable: ticketsAvailable,
+		ticketsRequested: item.Quantity,
+	}
+}
+
+// releaseBookedTickets puts the tickets of a canceled booking back into the
+// show's and its categories' inventory.
+func releaseBookedTickets(ctx context.Context, tx *sql.Tx, booking entity.Booking) error {
+	_, err := tx.ExecContext(ctx, `UPDATE show_inventory
+		SET tickets_available = tickets_available + $2
+		WHERE show_id = $1`, booking.ShowID, booking.NumberOfTickets)
+	if err != nil {
+		return fmt.Errorf("releasing tickets: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE show_ticket_categories c
+		SET tickets_available = c.tickets_available + i.quantity
+		FROM booking_items i
+		WHERE i.booking_id = $1 AND c.show_id = $2 AND c.name = i.category`, booking.BookingID, booking.ShowID)
+	if err != nil {
+		return fmt.Errorf("releasing category tickets: %w", err)
+	}
+
+	return nil
+}
+
+// releaseExpiredHoldsQuery expires active holds past their expiry, of one show
+// or of all shows if $4 is empty, and puts their tickets back.
+const releaseExpiredHoldsQuery = `WITH released AS (
+		UPDATE seat_holds SET status = $1
+		WHERE status = $2 AND expires_at <= $3
+			AND (NULLIF($4, '')::uuid IS NULL OR show_id = NULLIF($4, '')::uuid)
+		RETURNING show_id, number_of_tickets
+	), restocked AS (
+		UPDATE show_inventory i
+		SET tickets_available = i.tickets_available + r.tickets
+		FROM (SELECT show_id, SUM(number_of_tickets) AS tickets FROM released GROUP BY show_id) r
+		WHERE i.show_id = r.show_id
+	)
+	SELECT count(*) FROM released`
+
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func releaseExpiredHolds(ctx context.Context, q rowQuerier, now time.Time, showID string) (int64, error) {
+	var released int64
+	row := q.QueryRowContext(ctx, releaseExpiredHoldsQuery,
+		entity.SeatHoldExpired, entity.SeatHoldActive, now, showID)
+	if err := row.Scan(&released); err != nil {
+		return 0, fmt.Errorf("releasing expired seat holds: %w", err)
+	}
+
+	return released, nil
+}
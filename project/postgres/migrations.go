@@ -0,0 +1,481 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// migrationsLockID is the key of the advisory lock held while migrating, so
+// replicas starting at the same time apply migrations one after another.
+const migrationsLockID = 7_301_994_512
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// migrations must only ever be appended to. Version 1 uses IF NOT EXISTS so it
+// can be applied to databases created before migrations were introduced.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create bookings, shows and tickets",
+		up: `CREATE TABLE IF NOT EXISTS bookings (
+			booking_id UUID PRIMARY KEY,
+			show_id UUID NOT NULL,
+			number_of_tickets INTEGER NOT NULL,
+			customer_email VARCHAR(255) NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS shows (
+			show_id UUID PRIMARY KEY,
+			dead_nation_id UUID NOT NULL,
+			number_of_tickets INTEGER NOT NULL,
+			start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+			title VARCHAR(255) NOT NULL,
+			venue VARCHAR(255) NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS tickets (
+			ticket_id UUID PRIMARY KEY,
+			price_amount NUMERIC(10, 2) NOT NULL,
+			price_currency CHAR(3) NOT NULL,
+			customer_email VARCHAR(255) NOT NULL
+		);`,
+		down: `DROP TABLE tickets;
+		DROP TABLE shows;
+		DROP TABLE bookings;`,
+	},
+	{
+		version: 2,
+		name:    "create message blocklist",
+		up: `CREATE TABLE IF NOT EXISTS message_blocklist (
+			entry_id UUID PRIMARY KEY,
+			message_uuid VARCHAR(255),
+			event_name VARCHAR(255),
+			handler_name VARCHAR(255),
+			reason TEXT NOT NULL,
+			expires_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+			skipped_count INTEGER NOT NULL DEFAULT 0,
+			last_skipped_at TIMESTAMP WITH TIME ZONE,
+			CHECK (message_uuid IS NOT NULL OR event_name IS NOT NULL OR handler_name IS NOT NULL)
+		);
+
+		INSERT INTO message_blocklist (entry_id, message_uuid, reason)
+		VALUES ('5c2c7a5e-3f0e-4d8a-9c1b-6f0a2f1b7e11', '2beaf5bc-d5e4-4653-b075-2b36bbf28949', 'invalid event')
+		ON CONFLICT DO NOTHING;`,
+		down: `DROP TABLE message_blocklist;`,
+	},
+	{
+		version: 3,
+		name:    "add bookings canceled_at",
+		up:      `ALTER TABLE bookings ADD COLUMN canceled_at TIMESTAMP WITH TIME ZONE;`,
+		down:    `ALTER TABLE bookings DROP COLUMN canceled_at;`,
+	},
+	{
+		version: 4,
+		name:    "create booking sagas",
+		up: `CREATE TABLE booking_sagas (
+			booking_id UUID PRIMARY KEY REFERENCES bookings (booking_id),
+			show_id UUID NOT NULL,
+			status VARCHAR(32) NOT NULL,
+			failure_reason TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+		);
+
+		INSERT INTO booking_sagas (booking_id, show_id, status)
+		SELECT booking_id, show_id, 'confirmed' FROM bookings;`,
+		down: `DROP TABLE booking_sagas;`,
+	},
+	{
+		version: 5,
+		name:    "create processed messages inbox",
+		up: `CREATE TABLE processed_messages (
+			handler_name VARCHAR(255) NOT NULL,
+			message_key VARCHAR(512) NOT NULL,
+			processed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+			PRIMARY KEY (handler_name, message_key)
+		);
+
+		CREATE INDEX processed_messages_processed_at_idx ON processed_messages (processed_at);`,
+		down: `DROP TABLE processed_messages;`,
+	},
+	{
+		version: 6,
+		name:    "create events store",
+		up: `CREATE TABLE events (
+			sequence BIGSERIAL PRIMARY KEY,
+			event_id VARCHAR(255) NOT NULL UNIQUE,
+			event_name VARCHAR(255) NOT NULL,
+			payload JSONB NOT NULL,
+			metadata JSONB NOT NULL,
+			correlation_id VARCHAR(255) NOT NULL,
+			published_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			stored_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+		);
+
+		CREATE INDEX events_event_name_published_at_idx ON events (event_name, published_at);
+
+		CREATE RULE events_no_update AS ON UPDATE TO events DO INSTEAD NOTHING;
+		CREATE RULE events_no_delete AS ON DELETE TO events DO INSTEAD NOTHING;`,
+		down: `DROP TABLE events;`,
+	},
+	{
+		version: 7,
+		name:    "create seat holds",
+		up: `CREATE TABLE seat_holds (
+			hold_id UUID PRIMARY KEY,
+			show_id UUID NOT NULL REFERENCES shows (show_id),
+			number_of_tickets INT NOT NULL,
+			customer_email VARCHAR(255) NOT NULL,
+			status VARCHAR(32) NOT NULL,
+			booking_id UUID REFERENCES bookings (booking_id),
+			expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+		);
+
+		CREATE INDEX seat_holds_active_idx ON seat_holds (show_id, expires_at) WHERE status = 'active';`,
+		down: `DROP TABLE seat_holds;`,
+	},
+	{
+		version: 8,
+		name:    "create waitlist entries",
+		up: `CREATE TABLE waitlist_entries (
+			entry_id UUID PRIMARY KEY,
+			position BIGSERIAL NOT NULL,
+			show_id UUID NOT NULL REFERENCES shows (show_id),
+			customer_email VARCHAR(255) NOT NULL,
+			number_of_tickets INT NOT NULL,
+			status VARCHAR(32) NOT NULL,
+			hold_id UUID REFERENCES seat_holds (hold_id),
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+		);
+
+		CREATE INDEX waitlist_entries_show_id_position_idx ON waitlist_entries (show_id, position)
+			WHERE status IN ('waiting', 'offered');`,
+		down: `DROP TABLE waitlist_entries;`,
+	},
+	{
+		version: 9,
+		name:    "create ticket categories",
+		up: `CREATE TABLE show_ticket_categories (
+			show_id UUID NOT NULL REFERENCES shows (show_id),
+			name VARCHAR(255) NOT NULL,
+			capacity INT NOT NULL,
+			price_amount NUMERIC(12, 2) NOT NULL,
+			price_currency VARCHAR(3) NOT NULL,
+			PRIMARY KEY (show_id, name)
+		);
+
+		CREATE TABLE booking_items (
+			booking_id UUID NOT NULL REFERENCES bookings (booking_id),
+			category VARCHAR(255) NOT NULL,
+			quantity INT NOT NULL,
+			unit_price_amount NUMERIC(12, 2) NOT NULL,
+			unit_price_currency VARCHAR(3) NOT NULL,
+			PRIMARY KEY (booking_id, category)
+		);
+
+		ALTER TABLE bookings
+			ADD COLUMN total_price_amount NUMERIC(12, 2),
+			ADD COLUMN total_price_currency VARCHAR(3);`,
+		down: `ALTER TABLE bookings
+			DROP COLUMN total_price_amount,
+			DROP COLUMN total_price_currency;
+
+		DROP TABLE booking_items;
+		DROP TABLE show_ticket_categories;`,
+	},
+	{
+		version: 10,
+		name:    "create promo codes",
+		up: `CREATE TABLE promo_codes (
+			code VARCHAR(64) PRIMARY KEY,
+			discount_type VARCHAR(16) NOT NULL,
+			discount_value NUMERIC(12, 2) NOT NULL,
+			currency VARCHAR(3),
+			show_id UUID REFERENCES shows (show_id),
+			max_redemptions INT,
+			redemptions INT NOT NULL DEFAULT 0,
+			valid_from TIMESTAMP WITH TIME ZONE,
+			valid_until TIMESTAMP WITH TIME ZONE,
+			disabled_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+		);
+
+		ALTER TABLE bookings
+			ADD COLUMN promo_code VARCHAR(64) REFERENCES promo_codes (code),
+			ADD COLUMN discount_amount NUMERIC(12, 2);`,
+		down: `ALTER TABLE bookings
+			DROP COLUMN promo_code,
+			DROP COLUMN discount_amount;
+
+		DROP TABLE promo_codes;`,
+	},
+	{
+		version: 11,
+		name:    "add ticket status history",
+		up: `ALTER TABLE tickets
+			ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'confirmed',
+			ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+
+		CREATE TABLE ticket_status_history (
+			id BIGSERIAL PRIMARY KEY,
+			ticket_id UUID NOT NULL REFERENCES tickets (ticket_id),
+			status VARCHAR(16) NOT NULL,
+			correlation_id VARCHAR(255) NOT NULL,
+			changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+		);
+
+		CREATE INDEX ticket_status_history_ticket_id_idx ON ticket_status_history (ticket_id, id);
+
+		INSERT INTO ticket_status_history (ticket_id, status, correlation_id)
+			SELECT ticket_id, status, '' FROM tickets;`,
+		down: `DROP TABLE ticket_status_history;
+
+		ALTER TABLE tickets
+			DROP COLUMN status,
+			DROP COLUMN updated_at;`,
+	},
+	{
+		version: 12,
+		name:    "add tickets last event time",
+		up:      `ALTER TABLE tickets ADD COLUMN last_event_at TIMESTAMP WITH TIME ZONE;`,
+		down:    `ALTER TABLE tickets DROP COLUMN last_event_at;`,
+	},
+	{
+		version: 13,
+		name:    "create refunds",
+		up: `CREATE TABLE refunds (
+			refund_id UUID PRIMARY KEY,
+			ticket_id UUID NOT NULL,
+			idempotency_key VARCHAR(255) NOT NULL UNIQUE,
+			status VARCHAR(32) NOT NULL,
+			failure_reason TEXT,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+		);`,
+		down: `DROP TABLE refunds;`,
+	},
+	{
+		version: 14,
+		name:    "create command steps",
+		up: `CREATE TABLE command_steps (
+			command_name VARCHAR(255) NOT NULL,
+			idempotency_key VARCHAR(255) NOT NULL,
+			step VARCHAR(255) NOT NULL,
+			completed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+			PRIMARY KEY (command_name, idempotency_key, step)
+		);
+
+		CREATE INDEX command_steps_completed_at_idx ON command_steps (completed_at);`,
+		down: `DROP TABLE command_steps;`,
+	},
+	{
+		version: 15,
+		name:    "add refund policy columns",
+		up: `ALTER TABLE shows ADD COLUMN non_refundable BOOLEAN NOT NULL DEFAULT false;
+
+		ALTER TABLE tickets ADD COLUMN booking_id UUID;
+
+		ALTER TABLE refunds
+			ADD COLUMN amount NUMERIC(12, 2),
+			ADD COLUMN currency VARCHAR(3);`,
+		down: `ALTER TABLE refunds
+			DROP COLUMN amount,
+			DROP COLUMN currency;
+
+		ALTER TABLE tickets DROP COLUMN booking_id;
+
+		ALTER TABLE shows DROP COLUMN non_refundable;`,
+	},
+	{
+		version: 16,
+		name:    "create show inventory",
+		up: `CREATE TABLE show_inventory (
+			show_id UUID PRIMARY KEY REFERENCES shows (show_id),
+			tickets_available INT NOT NULL CHECK (tickets_available >= 0)
+		);
+
+		INSERT INTO show_inventory (show_id, tickets_available)
+			SELECT s.show_id, GREATEST(s.number_of_tickets
+				- (SELECT coalesce(SUM(b.number_of_tickets), 0) FROM bookings b
+					WHERE b.show_id = s.show_id AND b.canceled_at IS NULL)
+				- (SELECT coalesce(SUM(h.number_of_tickets), 0) FROM seat_holds h
+					WHERE h.show_id = s.show_id AND h.status = 'active'),
+			0)
+			FROM shows s;
+
+		ALTER TABLE show_ticket_categories ADD COLUMN tickets_available INT CHECK (tickets_available >= 0);
+
+		UPDATE show_ticket_categories c SET tickets_available = GREATEST(c.capacity
+			- (SELECT coalesce(SUM(i.quantity), 0)
+				FROM booking_items i
+				JOIN bookings b ON b.booking_id = i.booking_id
+				WHERE b.show_id = c.show_id AND b.canceled_at IS NULL AND i.category = c.name),
+		0);
+
+		ALTER TABLE show_ticket_categories ALTER COLUMN tickets_available SET NOT NULL;`,
+		down: `ALTER TABLE show_ticket_categories DROP COLUMN tickets_available;
+
+		DROP TABLE show_inventory;`,
+	},
+	{
+		version: 17,
+		name:    "add processed messages claims",
+		up: `ALTER TABLE processed_messages
+			ADD COLUMN claimed_until TIMESTAMP WITH TIME ZONE,
+			ADD COLUMN completed_at TIMESTAMP WITH TIME ZONE;
+
+		UPDATE processed_messages SET completed_at = processed_at;`,
+		down: `ALTER TABLE processed_messages
+			DROP COLUMN claimed_until,
+			DROP COLUMN completed_at;`,
+	},
+	{
+		version: 18,
+		name:    "add command step claims",
+		up: `ALTER TABLE command_steps
+			ADD COLUMN claimed_until TIMESTAMP WITH TIME ZONE,
+			ALTER COLUMN completed_at DROP NOT NULL,
+			ALTER COLUMN completed_at DROP DEFAULT;`,
+		down: `DELETE FROM command_steps WHERE completed_at IS NULL;
+
+		ALTER TABLE command_steps
+			DROP COLUMN claimed_until,
+			ALTER COLUMN completed_at SET DEFAULT now(),
+			ALTER COLUMN completed_at SET NOT NULL;`,
+	},
+	{
+		version: 19,
+		name:    "add ticket placeholders",
+		up:      `ALTER TABLE tickets ADD COLUMN placeholder BOOLEAN NOT NULL DEFAULT false;`,
+		down: `DELETE FROM ticket_status_history WHERE ticket_id IN (SELECT ticket_id FROM tickets WHERE placeholder);
+
+		DELETE FROM tickets WHERE placeholder;
+
+		ALTER TABLE tickets DROP COLUMN placeholder;`,
+	},
+	{
+		version: 20,
+		name:    "create receipt prices",
+		up: `CREATE TABLE receipt_prices (
+			ticket_id UUID PRIMARY KEY,
+			booking_id UUID NOT NULL REFERENCES bookings (booking_id),
+			amount NUMERIC(12, 2) NOT NULL
+		);
+
+		CREATE INDEX receipt_prices_booking_id_idx ON receipt_prices (booking_id);`,
+		down: `DROP TABLE receipt_prices;`,
+	},
+}
+
+// Migrate applies all pending migrations in version order.
+func Migrate(ctx context.Context, db *sqlx.DB) error {
+	return withMigrationsLock(ctx, db, func(conn *sql.Conn, applied int) error {
+		for _, m := range migrations {
+			if m.version <= applied {
+				continue
+			}
+
+			if err := applyMigration(ctx, conn, m.version, m.up, `INSERT INTO schema_migrations
+				(version, name) VALUES ($1, $2)`, m.version, m.name); err != nil {
+				return fmt.Errorf("applying migration %d (%s): %w", m.version, m.name, err)
+			}
+
+			logrus.WithField("version", m.version).Infof("applied migration: %s", m.name)
+		}
+
+		return nil
+	})
+}
+
+// MigrateDown reverts applied migrations until the schema is at targetVersion.
+func MigrateDown(ctx context.Context, db *sqlx.DB, targetVersion int) error {
+	return withMigrationsLock(ctx, db, func(conn *sql.Conn, applied int) error {
+		for i := len(migrations) - 1; i >= 0; i-- {
+			m := migrations[i]
+			if m.version > applied || m.version <= targetVersion {
+				continue
+			}
+
+			if err := applyMigration(ctx, conn, m.version, m.down, `DELETE FROM schema_migrations
+				WHERE version = $1`, m.version); err != nil {
+				return fmt.Errorf("reverting migration %d (%s): %w", m.version, m.name, err)
+			}
+
+			logrus.WithField("version", m.version).Infof("reverted migration: %s", m.name)
+		}
+
+		return nil
+	})
+}
+
+func withMigrationsLock(ctx context.Context, db *sqlx.DB, fn func(conn *sql.Conn, applied int) error) (err error) {
+	// Advisory locks are held by the session, so every statement must use the same connection.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("getting db connection: %w", err)
+	}
+	defer func() {
+		err = errors.Join(err, conn.Close())
+	}()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationsLockID); err != nil {
+		return fmt.Errorf("acquiring migrations lock: %w", err)
+	}
+	defer func() {
+		_, unlockErr := conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", migrationsLockID)
+		if unlockErr != nil {
+			err = errors.Join(err, fmt.Errorf("releasing migrations lock: %w", unlockErr))
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	);`); err != nil {
+		return fmt.Errorf("creating schema migrations table: %w", err)
+	}
+
+	var applied int
+	row := conn.QueryRowContext(ctx, "SELECT coalesce(MAX(version), 0) FROM schema_migrations")
+	if err := row.Scan(&applied); err != nil {
+		return fmt.Errorf("getting applied schema version: %w", err)
+	}
+
+	return fn(conn, applied)
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, version int, statements string, record string, recordArgs ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, statements); err != nil {
+		return errors.Join(fmt.Errorf("executing migration: %w", err), tx.Rollback())
+	}
+
+	if _, err := tx.ExecContext(ctx, record, recordArgs...); err != nil {
+		return errors.Join(fmt.Errorf("recording schema version %d: %w", version, err), tx.Rollback())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
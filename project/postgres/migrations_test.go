@@ -0,0 +1,26 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+
+	"tickets/postgres"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestMigrate_Concurrently(t *testing.T) {
+	g, ctx := errgroup.WithContext(context.Background())
+	for range 5 {
+		g.Go(func() error {
+			return postgres.Migrate(ctx, db)
+		})
+	}
+	require.NoError(t, g.Wait())
+
+	var applied, latest int
+	require.NoError(t, db.Get(&applied, "SELECT count(*) FROM schema_migrations"))
+	require.NoError(t, db.Get(&latest, "SELECT MAX(version) FROM schema_migrations"))
+	require.Equal(t, latest, applied)
+}
@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+type OutboxRepo struct {
+	db  *sqlx.DB
+	bus TxBus
+}
+
+func NewOutboxRepo(db *sqlx.DB, bus TxBus) OutboxRepo {
+	return OutboxRepo{
+		db:  db,
+		bus: bus,
+	}
+}
+
+// PublishAll publishes the events in a single transaction, so either all of
+// them are published or none.
+func (r OutboxRepo) PublishAll(ctx context.Context, events []any) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	if err := r.bus.Publish(ctx, tx, events...); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"tickets/entity"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type promoCodeNotFoundError struct {
+	code string
+}
+
+func (e promoCodeNotFoundError) Error() string {
+	return fmt.Sprintf("promo code %s not found", e.code)
+}
+
+func (e promoCodeNotFoundError) NotFound() bool {
+	return true
+}
+
+type promoCodeAlreadyExistsError struct {
+	code string
+}
+
+func (e promoCodeAlreadyExistsError) Error() string {
+	return fmt.Sprintf("promo code %s already exists", e.code)
+}
+
+func (e promoCodeAlreadyExistsError) AlreadyExists() bool {
+	return true
+}
+
+type promoCodeNotApplicableError struct {
+	code   string
+	reason string
+}
+
+func (e promoCodeNotApplicableError) Error() string {
+	return fmt.Sprintf("promo code %s %s", e.code, e.reason)
+}
+
+func (e promoCodeNotApplicableError) InvalidPromoCode() bool {
+	return true
+}
+
+type PromoCodeRepo struct {
+	db *sqlx.DB
+}
+
+func NewPromoCodeRepo(db *sqlx.DB) PromoCodeRepo {
+	return PromoCodeRepo{
+		db: db,
+	}
+}
+
+func (r PromoCodeRepo) Add(ctx context.Context, promoCode entity.PromoCode) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO promo_codes
+		(code, discount_type, discount_value, currency, show_id, max_redemptions, valid_from, valid_until)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, '')::uuid, $6, $7, $8);`,
+		promoCode.Code, promoCode.DiscountType, promoCode.DiscountValue, promoCode.Currency, promoCode.ShowID,
+		promoCode.MaxRedemptions, promoCode.ValidFrom, promoCode.ValidUntil)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation" {
+		return promoCodeAlreadyExistsError{code: promoCode.Code}
+	}
+
+	return err
+}
+
+func (r PromoCodeRepo) List(ctx context.Context) ([]entity.PromoCode, error) {
+	rows, err := r.db.QueryxContext(ctx, `SELECT code, discount_type, discount_value::text, coalesce(currency, ''),
+		coalesce(show_id::text, ''), max_redemptions, redemptions, valid_from, valid_until, disabled_at, created_at
+		FROM promo_codes ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("querying db: %w", err)
+	}
+	defer rows.Close()
+
+	var promoCodes []entity.PromoCode
+	for rows.Next() {
+		var p entity.PromoCode
+		if err := rows.Scan(&p.Code, &p.DiscountType, &p.DiscountValue, &p.Currency, &p.ShowID, &p.MaxRedemptions,
+			&p.Redemptions, &p.ValidFrom, &p.ValidUntil, &p.DisabledAt, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+
+		promoCodes = append(promoCodes, p)
+	}
+
+	return promoCodes, rows.Err()
+}
+
+// Disable stops the code from being redeemed. Bookings that already used it
+// keep their discount.
+func (r PromoCodeRepo) Disable(ctx context.Context, code string) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE promo_codes SET disabled_at = coalesce(disabled_at, now())
+		WHERE code = $1`, code)
+	if err != nil {
+		return fmt.Errorf("disabling promo code: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting rows affected: %w", err)
+	}
+	if n == 0 {
+		return promoCodeNotFoundError{code: code}
+	}
+
+	return nil
+}
+
+// redeemPromoCode counts a redemption of the booking's promo code and takes
+// the discount off the booking's total price. It must run in the transaction
+// that stores the booking, so a failed booking doesn't use up the code.
+func redeemPromoCode(ctx context.Context, tx *sql.Tx, booking entity.Booking) (discount, total entity.Money, err error) {
+	if booking.TotalPrice == nil {
+		return entity.Money{}, entity.Money{}, promoCodeNotApplicableError{
+			code:   booking.PromoCode,
+			reason: "applies only to tickets booked per category",
+		}
+	}
+
+	row := tx.QueryRowContext(ctx, `UPDATE promo_codes SET redemptions = redemptions + 1
+		WHERE code = $1
+			AND disabled_at IS NULL
+			AND (show_id IS NULL OR show_id = $2)
+			AND (valid_from IS NULL OR valid_from <= now())
+			AND (valid_until IS NULL OR valid_until > now())
+			AND (max_redemptions IS NULL OR redemptions < max_redemptions)
+		RETURNING discount_type, discount_value::text, coalesce(currency, '')`,
+		booking.PromoCode, booking.ShowID)
+
+	var p entity.PromoCode
+	err = row.Scan(&p.DiscountType, &p.DiscountValue, &p.Currency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Money{}, entity.Money{}, promoCodeNotRedeemable(ctx, tx, booking)
+	}
+	if err != nil {
+		return entity.Money{}, entity.Money{}, fmt.Errorf("redeeming promo code: %w", err)
+	}
+
+	if p.DiscountType == entity.DiscountFixed && p.Currency != booking.TotalPrice.Currency {
+		return entity.Money{}, entity.Money{}, promoCodeNotApplicableError{
+			code:   booking.PromoCode,
+			reason: fmt.Sprintf("is in %s, but the booking is in %s", p.Currency, booking.TotalPrice.Currency),
+		}
+	}
+
+	discount.Currency = booking.TotalPrice.Currency
+	total.Currency = booking.TotalPrice.Currency
+	row = tx.QueryRowContext(ctx, `WITH d AS (
+			SELECT CASE WHEN $3 = 'percentage'
+				THEN ROUND(total_price_amount * $4::numeric / 100, 2)
+				ELSE LEAST($4::numeric, total_price_amount)
+			END AS amount
+			FROM bookings WHERE booking_id = $1
+		)
+		UPDATE bookings b
+		SET promo_code = $2,
+			discount_amount = d.amount,
+			total_price_amount = b.total_price_amount - d.amount
+		FROM d
+		WHERE b.booking_id = $1
+		RETURNING b.discount_amount::text, b.total_price_amount::text`,
+		booking.BookingID, booking.PromoCode, p.DiscountType, p.DiscountValue)
+	if err := row.Scan(&discount.Amount, &total.Amount); err != nil {
+		return entity.Money{}, entity.Money{}, fmt.Errorf("applying discount: %w", err)
+	}
+
+	return discount, total, nil
+}
+
+// promoCodeNotRedeemable explains why the booking's promo code can't be redeemed.
+func promoCodeNotRedeemable(ctx context.Context, tx *sql.Tx, booking entity.Booking) error {
+	row := tx.QueryRowContext(ctx, `SELECT coalesce(show_id::text, ''), max_redemptions, redemptions,
+			valid_from, valid_until, disabled_at
+		FROM promo_codes WHERE code = $1`, booking.PromoCode)
+
+	var p entity.PromoCode
+	err := row.Scan(&p.ShowID, &p.MaxRedemptions, &p.Redemptions, &p.ValidFrom, &p.ValidUntil, &p.DisabledAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return promoCodeNotApplicableError{code: booking.PromoCode, reason: "does not exist"}
+	}
+	if err != nil {
+		return fmt.Errorf("getting promo code: %w", err)
+	}
+
+	now := time.Now()
+	var reason string
+	switch {
+	case p.DisabledAt != nil:
+		reason = "is disabled"
+	case p.ShowID != "" && p.ShowID != booking.ShowID:
+		reason = "is not valid for this show"
+	case p.ValidFrom != nil && now.Before(*p.ValidFrom):
+		reason = "is not valid yet"
+	case p.ValidUntil != nil && !now.Before(*p.ValidUntil):
+		reason = "has expired"
+	case p.MaxRedemptions != nil && p.Redemptions >= *p.MaxRedemptions:
+		reason = "has been fully redeemed"
+	default:
+		reason = "can't be redeemed"
+	}
+
+	return promoCodeNotApplicableError{code: booking.PromoCode, reason: reason}
+}
@@ -0,0 +1,174 @@
+package postgres_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"tickets/entity"
+	"tickets/message/event"
+	"tickets/postgres"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBookingRepo_Add_promoCode(t *testing.T) {
+	ctx := context.Background()
+	showRepo := postgres.NewShowRepo(db)
+	promoCodeRepo := postgres.NewPromoCodeRepo(db)
+	r := postgres.NewBookingRepo(db, newOutboxTxBus(t))
+
+	show := entity.Show{
+		ShowID:          uuid.NewString(),
+		DeadNationID:    uuid.NewString(),
+		NumberOfTickets: 10,
+		StartTime:       time.Now().UTC().Truncate(time.Second),
+		Title:           "Test show",
+		Venue:           "Test venue",
+		Categories: []entity.TicketCategory{
+			{Name: "standing", Capacity: 10, Price: entity.Money{Amount: "30.00", Currency: "EUR"}},
+		},
+	}
+	require.NoError(t, showRepo.Add(ctx, show))
+
+	maxRedemptions := uint(1)
+	promoCode := entity.PromoCode{
+		Code:           "TEST-" + uuid.NewString(),
+		DiscountType:   entity.DiscountPercentage,
+		DiscountValue:  "15",
+		ShowID:         show.ShowID,
+		MaxRedemptions: &maxRedemptions,
+	}
+	require.NoError(t, promoCodeRepo.Add(ctx, promoCode))
+
+	newBooking := func() entity.Booking {
+		return entity.Booking{
+			BookingID:       uuid.NewString(),
+			ShowID:          show.ShowID,
+			NumberOfTickets: 2,
+			CustomerEmail:   "test@example.com",
+			Items:           []entity.BookingItem{{Category: "standing", Quantity: 2}},
+			PromoCode:       promoCode.Code,
+		}
+	}
+
+	booking := newBooking()
+	require.NoError(t, r.Add(ctx, booking))
+
+	var discount, total string
+	row := db.QueryRowContext(ctx, `SELECT discount_amount::text, total_price_amount::text
+		FROM bookings WHERE booking_id = $1`, booking.BookingID)
+	require.NoError(t, row.Scan(&discount, &total))
+	assert.Equal(t, "9.00", discount)
+	assert.Equal(t, "51.00", total)
+
+	stored, err := r.Get(ctx, booking.BookingID)
+	require.NoError(t, err)
+	assert.Equal(t, &entity.Money{Amount: "9.00", Currency: "EUR"}, stored.Discount)
+	assert.Equal(t, &entity.Money{Amount: "51.00", Currency: "EUR"}, stored.TotalPrice)
+
+	err = r.Add(ctx, newBooking())
+	var invalidPromoCodeErr interface{ InvalidPromoCode() bool }
+	assert.ErrorAs(t, err, &invalidPromoCodeErr, "redemptions should be capped")
+
+	availability, err := showRepo.GetAvailability(ctx, show.ShowID)
+	require.NoError(t, err)
+	assert.Equal(t, uint(8), availability.TicketsAvailable, "rejected booking should not be stored")
+
+	promoCodes, err := promoCodeRepo.List(ctx)
+	require.NoError(t, err)
+	for _, p := range promoCodes {
+		if p.Code == promoCode.Code {
+			assert.Equal(t, uint(1), p.Redemptions)
+		}
+	}
+
+	require.NoError(t, promoCodeRepo.Disable(ctx, promoCode.Code))
+	var notFoundErr interface{ NotFound() bool }
+	assert.ErrorAs(t, promoCodeRepo.Disable(ctx, "missing-"+uuid.NewString()), &notFoundErr)
+}
+
+func TestBookingRepo_ReceiptPrice(t *testing.T) {
+	ctx := context.Background()
+	showRepo := postgres.NewShowRepo(db)
+	promoCodeRepo := postgres.NewPromoCodeRepo(db)
+	r := postgres.NewBookingRepo(db, newOutboxTxBus(t))
+
+	show := entity.Show{
+		ShowID:          uuid.NewString(),
+		DeadNationID:    uuid.NewString(),
+		NumberOfTickets: 10,
+		StartTime:       time.Now().UTC().Truncate(time.Second),
+		Title:           "Test show",
+		Venue:           "Test venue",
+		Categories: []entity.TicketCategory{
+			{Name: "standing", Capacity: 10, Price: entity.Money{Amount: "10.00", Currency: "EUR"}},
+		},
+	}
+	require.NoError(t, showRepo.Add(ctx, show))
+
+	// A third of the discount isn't a whole number of cents.
+	promoCode := entity.PromoCode{
+		Code:          "TEST-" + uuid.NewString(),
+		DiscountType:  entity.DiscountFixed,
+		DiscountValue: "10.00",
+		Currency:      "EUR",
+		ShowID:        show.ShowID,
+	}
+	require.NoError(t, promoCodeRepo.Add(ctx, promoCode))
+
+	booking := entity.Booking{
+		BookingID:       uuid.NewString(),
+		ShowID:          show.ShowID,
+		NumberOfTickets: 3,
+		CustomerEmail:   "test@example.com",
+		Items:           []entity.BookingItem{{Category: "standing", Quantity: 3}},
+		PromoCode:       promoCode.Code,
+	}
+	require.NoError(t, r.Add(ctx, booking))
+
+	receipts := &receiptsRecorder{}
+	h := event.NewHandler(r, nil, nil, nil, receipts, nil, nil, nil, nil, nil)
+
+	tickets := make([]entity.Ticket, booking.NumberOfTickets)
+	for i := range tickets {
+		tickets[i] = entity.Ticket{
+			ID:            uuid.NewString(),
+			BookingID:     booking.BookingID,
+			CustomerEmail: booking.CustomerEmail,
+			Price:         entity.Money{Amount: "10.00", Currency: "EUR"},
+		}
+
+		e := event.NewTicketBookingConfirmed(uuid.NewString(), tickets[i])
+		require.NoError(t, h.IssueReceipt(ctx, &e))
+	}
+
+	sum := new(big.Rat)
+	for _, price := range receipts.prices {
+		amount, ok := new(big.Rat).SetString(price.Amount)
+		require.True(t, ok)
+		sum.Add(sum, amount)
+	}
+	assert.Equal(t, "20.00", sum.FloatString(2), "receipts should add up to the booking's total price")
+	assert.Equal(t, []entity.Money{
+		{Amount: "6.67", Currency: "EUR"},
+		{Amount: "6.67", Currency: "EUR"},
+		{Amount: "6.66", Currency: "EUR"},
+	}, receipts.prices)
+
+	e := event.NewTicketBookingConfirmed(uuid.NewString(), tickets[2])
+	require.NoError(t, h.IssueReceipt(ctx, &e))
+	assert.Equal(t, entity.Money{Amount: "6.66", Currency: "EUR"}, receipts.prices[3], "retried receipt should keep its price")
+}
+
+type receiptsRecorder struct {
+	prices []entity.Money
+}
+
+func (r *receiptsRecorder) IssueReceipt(_ context.Context, _, _ string, price entity.Money) error {
+	r.prices = append(r.prices, price)
+	return nil
+}
@@ -0,0 +1,237 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"tickets/entity"
+	"tickets/message/command"
+	"tickets/message/event"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+type refundNotFoundError struct {
+	refundID string
+}
+
+func (e refundNotFoundError) Error() string {
+	return fmt.Sprintf("refund %s not found", e.refundID)
+}
+
+func (e refundNotFoundError) NotFound() bool {
+	return true
+}
+
+const refundQuery = `SELECT refund_id, ticket_id, idempotency_key, status, amount::text, currency,
+		coalesce(failure_reason, ''), created_at, updated_at
+	FROM refunds`
+
+type RefundRepo struct {
+	db  *sqlx.DB
+	bus TxBus
+}
+
+func NewRefundRepo(db *sqlx.DB, bus TxBus) RefundRepo {
+	return RefundRepo{
+		db:  db,
+		bus: bus,
+	}
+}
+
+// Add stores a requested refund and sends the command to make it in a single
+// transaction. A refund already requested with the same idempotency key is
+// returned instead, and its command sent again; the idempotency key keeps the
+// refund from being made twice.
+func (r RefundRepo) Add(ctx context.Context, refund entity.Refund) (entity.Refund, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return entity.Refund{}, fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	stored, err := r.add(ctx, tx, refund)
+	if err != nil {
+		return entity.Refund{}, errors.Join(err, tx.Rollback())
+	}
+
+	if err = tx.Commit(); err != nil {
+		return entity.Refund{}, fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return stored, nil
+}
+
+func (r RefundRepo) add(ctx context.Context, tx *sqlx.Tx, refund entity.Refund) (entity.Refund, error) {
+	var amount, currency *string
+	if refund.Amount != nil {
+		amount, currency = &refund.Amount.Amount, &refund.Amount.Currency
+	}
+
+	_, err := tx.ExecContext(ctx, `INSERT INTO refunds
+		(refund_id, ticket_id, idempotency_key, status, amount, currency)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (idempotency_key) DO NOTHING;`,
+		refund.RefundID, refund.TicketID, refund.IdempotencyKey, entity.RefundRequested, amount, currency)
+	if err != nil {
+		return entity.Refund{}, fmt.Errorf("inserting refund: %w", err)
+	}
+
+	row := tx.QueryRowxContext(ctx, refundQuery+` WHERE idempotency_key = $1`, refund.IdempotencyKey)
+
+	stored, err := scanRefund(row)
+	if err != nil {
+		return entity.Refund{}, fmt.Errorf("scanning row: %w", err)
+	}
+
+	cmd := command.NewRefundTicket(stored.RefundID, stored.TicketID, stored.IdempotencyKey, stored.Amount)
+	if err := r.bus.Send(ctx, tx, cmd); err != nil {
+		return entity.Refund{}, fmt.Errorf("sending refund ticket command in transaction: %w", err)
+	}
+
+	return stored, nil
+}
+
+func (r RefundRepo) GetByIdempotencyKey(ctx context.Context, idempotencyKey string) (entity.Refund, error) {
+	row := r.db.QueryRowxContext(ctx, refundQuery+` WHERE idempotency_key = $1`, idempotencyKey)
+
+	refund, err := scanRefund(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Refund{}, refundNotFoundError{refundID: idempotencyKey}
+	}
+	if err != nil {
+		return entity.Refund{}, fmt.Errorf("scanning row: %w", err)
+	}
+
+	return refund, nil
+}
+
+func (r RefundRepo) Get(ctx context.Context, refundID string) (entity.Refund, error) {
+	row := r.db.QueryRowxContext(ctx, refundQuery+` WHERE refund_id = $1`, refundID)
+
+	refund, err := scanRefund(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Refund{}, refundNotFoundError{refundID: refundID}
+	}
+	if err != nil {
+		return entity.Refund{}, fmt.Errorf("scanning row: %w", err)
+	}
+
+	return refund, nil
+}
+
+// MarkPaymentRefunded moves a requested refund on once the payment is refunded.
+func (r RefundRepo) MarkPaymentRefunded(ctx context.Context, refundID string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE refunds
+		SET status = $2, updated_at = now()
+		WHERE refund_id = $1 AND status = $3`,
+		refundID, entity.RefundPaymentRefunded, entity.RefundRequested)
+	if err != nil {
+		return fmt.Errorf("updating refund: %w", err)
+	}
+
+	return nil
+}
+
+// Complete marks the refund's receipt voided and publishes TicketRefunded in
+// a single transaction. Completing a refund again does nothing.
+func (r RefundRepo) Complete(ctx context.Context, refundID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	if err := r.complete(ctx, tx, refundID); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r RefundRepo) complete(ctx context.Context, tx *sql.Tx, refundID string) error {
+	row := tx.QueryRowContext(ctx, `UPDATE refunds
+		SET status = $2, updated_at = now()
+		WHERE refund_id = $1 AND status IN ($3, $4)
+		RETURNING ticket_id`,
+		refundID, entity.RefundReceiptVoided, entity.RefundRequested, entity.RefundPaymentRefunded)
+
+	refund := entity.Refund{RefundID: refundID}
+	err := row.Scan(&refund.TicketID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("updating refund: %w", err)
+	}
+
+	e := event.NewTicketRefunded(refundID, refund)
+
+	if err := r.bus.Publish(ctx, tx, e); err != nil {
+		return fmt.Errorf("publishing event in transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Fail marks an unfinished refund failed and publishes TicketRefundFailed in
+// a single transaction.
+func (r RefundRepo) Fail(ctx context.Context, refundID, reason string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	if err := r.fail(ctx, tx, refundID, reason); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r RefundRepo) fail(ctx context.Context, tx *sql.Tx, refundID, reason string) error {
+	row := tx.QueryRowContext(ctx, `UPDATE refunds
+		SET status = $2, failure_reason = $3, updated_at = now()
+		WHERE refund_id = $1 AND status IN ($4, $5)
+		RETURNING ticket_id`,
+		refundID, entity.RefundFailed, reason, entity.RefundRequested, entity.RefundPaymentRefunded)
+
+	refund := entity.Refund{RefundID: refundID, FailureReason: reason}
+	err := row.Scan(&refund.TicketID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("updating refund: %w", err)
+	}
+
+	e := event.NewTicketRefundFailed(refundID, refund)
+
+	if err := r.bus.Publish(ctx, tx, e); err != nil {
+		return fmt.Errorf("publishing event in transaction: %w", err)
+	}
+
+	return nil
+}
+
+func scanRefund(row interface{ Scan(dest ...any) error }) (entity.Refund, error) {
+	var (
+		r                entity.Refund
+		amount, currency sql.NullString
+	)
+	err := row.Scan(&r.RefundID, &r.TicketID, &r.IdempotencyKey, &r.Status, &amount, &currency,
+		&r.FailureReason, &r.CreatedAt, &r.UpdatedAt)
+	if amount.Valid {
+		r.Amount = &entity.Money{Amount: amount.String, Currency: currency.String}
+	}
+	return r, err
+}
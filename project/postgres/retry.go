@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	maxTxAttempts                       = 10
+	txRetryBaseDelay                    = 5 * time.Millisecond
+	txRetryMaxDelay                     = 500 * time.Millisecond
+	pqSerializationFailure pq.ErrorCode = "40001"
+	pqDeadlockDetected     pq.ErrorCode = "40P01"
+)
+
+// isTxConflict reports whether the transaction was aborted because of
+// a concurrent transaction, and would likely succeed if run again.
+func isTxConflict(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	return pqErr.Code == pqSerializationFailure || pqErr.Code == pqDeadlockDetected
+}
+
+// retryTxConflicts runs the transaction in run again while it fails with
+// a conflict, waiting a jittered, exponentially growing delay in between.
+// run must begin a new transaction on each call.
+func retryTxConflicts(ctx context.Context, run func() error) error {
+	delay := txRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := run()
+		if !isTxConflict(err) {
+			return err
+		}
+
+		if attempt == maxTxAttempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay/2 + rand.N(delay/2)):
+		}
+
+		delay = min(delay*2, txRetryMaxDelay)
+	}
+}
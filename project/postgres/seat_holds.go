@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"tickets/entity"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+type seatHoldNotFoundError struct {
+	holdID string
+}
+
+func (e seatHoldNotFoundError) Error() string {
+	return fmt.Sprintf("seat hold %s not found", e.holdID)
+}
+
+func (e seatHoldNotFoundError) NotFound() bool {
+	return true
+}
+
+type seatHoldExpiredError struct {
+	holdID string
+}
+
+func (e seatHoldExpiredError) Error() string {
+	return fmt.Sprintf("seat hold %s expired", e.holdID)
+}
+
+func (e seatHoldExpiredError) Expired() bool {
+	return true
+}
+
+type SeatHoldRepo struct {
+	db  *sqlx.DB
+	bus TxBus
+}
+
+func NewSeatHoldRepo(db *sqlx.DB, bus TxBus) SeatHoldRepo {
+	return SeatHoldRepo{
+		db:  db,
+		bus: bus,
+	}
+}
+
+// Add reserves the hold's seats if the show has enough of them available.
+func (r SeatHoldRepo) Add(ctx context.Context, hold entity.SeatHold) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	if err := addSeatHold(ctx, tx, hold); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func addSeatHold(ctx context.Context, tx *sql.Tx, hold entity.SeatHold) error {
+	if err := reserveTickets(ctx, tx, hold.ShowID, hold.NumberOfTickets); err != nil {
+		return err
+	}
+
+	return insertSeatHold(ctx, tx, hold)
+}
+
+func insertSeatHold(ctx context.Context, tx *sql.Tx, hold entity.SeatHold) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO seat_holds
+		(hold_id, show_id, number_of_tickets, customer_email, status, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6);`,
+		hold.HoldID, hold.ShowID, hold.NumberOfTickets, hold.CustomerEmail, entity.SeatHoldActive, hold.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("inserting seat hold: %w", err)
+	}
+
+	return nil
+}
+
+// Confirm turns an unexpired hold into a booking and publishes BookingMade.
+// Confirming an already confirmed hold returns the booking made the first time.
+func (r SeatHoldRepo) Confirm(ctx context.Context, holdID string) (entity.Booking, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.Booking{}, fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	booking, err := r.confirm(ctx, tx, holdID)
+	if err != nil {
+		return entity.Booking{}, errors.Join(err, tx.Rollback())
+	}
+
+	if err = tx.Commit(); err != nil {
+		return entity.Booking{}, fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return booking, nil
+}
+
+func (r SeatHoldRepo) confirm(ctx context.Context, tx *sql.Tx, holdID string) (entity.Booking, error) {
+	row := tx.QueryRowContext(ctx, `SELECT show_id, number_of_tickets, customer_email, status,
+			coalesce(booking_id::text, ''), expires_at <= now()
+		FROM seat_holds WHERE hold_id = $1 FOR UPDATE`, holdID)
+
+	var (
+		booking entity.Booking
+		status  string
+		expired bool
+	)
+	err := row.Scan(&booking.ShowID, &booking.NumberOfTickets, &booking.CustomerEmail, &status, &booking.BookingID, &expired)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Booking{}, seatHoldNotFoundError{holdID: holdID}
+	}
+	if err != nil {
+		return entity.Booking{}, fmt.Errorf("getting seat hold: %w", err)
+	}
+
+	if status == entity.SeatHoldConfirmed {
+		return booking, nil
+	}
+
+	if status != entity.SeatHoldActive || expired {
+		return entity.Booking{}, seatHoldExpiredError{holdID: holdID}
+	}
+
+	booking.BookingID = uuid.NewString()
+	if err := insertBooking(ctx, tx, r.bus, booking); err != nil {
+		return entity.Booking{}, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE seat_holds SET status = $2, booking_id = $3 WHERE hold_id = $1`,
+		holdID, entity.SeatHoldConfirmed, booking.BookingID)
+	if err != nil {
+		return entity.Booking{}, fmt.Errorf("confirming seat hold: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE waitlist_entries SET status = $2, updated_at = now()
+		WHERE hold_id = $1 AND status = $3`,
+		holdID, entity.WaitlistClaimed, entity.WaitlistOffered)
+	if err != nil {
+		return entity.Booking{}, fmt.Errorf("claiming waitlist offer: %w", err)
+	}
+
+	return booking, nil
+}
+
+// ReleaseExpired marks active holds past their expiry as expired, puts their
+// seats back and returns how many were released.
+func (r SeatHoldRepo) ReleaseExpired(ctx context.Context, now time.Time) (int64, error) {
+	return releaseExpiredHolds(ctx, r.db, now, "")
+}
@@ -0,0 +1,72 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"tickets/entity"
+	"tickets/postgres"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeatHoldRepo_Add(t *testing.T) {
+	ctx := context.Background()
+	showRepo := postgres.NewShowRepo(db)
+	r := postgres.NewSeatHoldRepo(db, newOutboxTxBus(t))
+
+	show := entity.Show{
+		ShowID:          uuid.NewString(),
+		DeadNationID:    uuid.NewString(),
+		NumberOfTickets: 10,
+		StartTime:       time.Now().UTC().Truncate(time.Second),
+		Title:           "Test show",
+		Venue:           "Test venue",
+	}
+	require.NoError(t, showRepo.Add(ctx, show))
+
+	hold := entity.SeatHold{
+		HoldID:          uuid.NewString(),
+		ShowID:          show.ShowID,
+		NumberOfTickets: 6,
+		CustomerEmail:   "test@example.com",
+		ExpiresAt:       time.Now().Add(time.Minute),
+	}
+	require.NoError(t, r.Add(ctx, hold))
+
+	expiredHold := hold
+	expiredHold.HoldID = uuid.NewString()
+	expiredHold.NumberOfTickets = 3
+	expiredHold.ExpiresAt = time.Now().Add(-time.Minute)
+	require.NoError(t, r.Add(ctx, expiredHold))
+
+	availability, err := showRepo.GetAvailability(ctx, show.ShowID)
+	require.NoError(t, err)
+	assert.Equal(t, uint(4), availability.TicketsAvailable, "only the unexpired hold should count")
+
+	released, err := r.ReleaseExpired(ctx, time.Now())
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, released, int64(1))
+
+	availability, err = showRepo.GetAvailability(ctx, show.ShowID)
+	require.NoError(t, err)
+	assert.Equal(t, uint(4), availability.TicketsAvailable, "released seats should stay available")
+
+	tooMany := hold
+	tooMany.HoldID = uuid.NewString()
+	tooMany.NumberOfTickets = 5
+	err = r.Add(ctx, tooMany)
+	var notEnoughTicketsErr interface{ NotEnoughTickets() bool }
+	assert.ErrorAs(t, err, &notEnoughTicketsErr)
+
+	_, err = r.Confirm(ctx, expiredHold.HoldID)
+	var expiredErr interface{ Expired() bool }
+	assert.ErrorAs(t, err, &expiredErr)
+
+	_, err = r.Confirm(ctx, uuid.NewString())
+	var notFoundErr interface{ NotFound() bool }
+	assert.ErrorAs(t, err, &notFoundErr)
+}
@@ -2,25 +2,41 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"tickets/entity"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
-func CreateShowsTable(ctx context.Context, db *sqlx.DB) error {
-	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS shows (
-		show_id UUID PRIMARY KEY,
-		dead_nation_id UUID NOT NULL,
-		number_of_tickets INTEGER NOT NULL,
-		start_time TIMESTAMP WITH TIME ZONE NOT NULL,
-		title VARCHAR(255) NOT NULL,
-		venue VARCHAR(255) NOT NULL
-	);`)
-	return err
+type showNotFoundError struct {
+	showID string
 }
 
+func (e showNotFoundError) Error() string {
+	return fmt.Sprintf("show %s not found", e.showID)
+}
+
+func (e showNotFoundError) NotFound() bool {
+	return true
+}
+
+// showAvailabilityQuery selects shows with the number of tickets neither
+// booked nor held. Seats of expired holds not yet released count as available.
+const showAvailabilityQuery = `SELECT s.show_id, s.dead_nation_id, s.number_of_tickets, s.start_time, s.title, s.venue, s.non_refundable,
+		i.tickets_available + (SELECT coalesce(SUM(h.number_of_tickets), 0) FROM seat_holds h
+			WHERE h.show_id = s.show_id AND h.status = 'active' AND h.expires_at <= now())
+	FROM shows s
+	JOIN show_inventory i ON i.show_id = s.show_id`
+
+// categoryAvailabilityQuery selects ticket categories with the number of
+// tickets not yet booked in each.
+const categoryAvailabilityQuery = `SELECT c.show_id, c.name, c.capacity, c.price_amount::text, c.price_currency, c.tickets_available
+	FROM show_ticket_categories c`
+
 type ShowRepo struct {
 	db *sqlx.DB
 }
@@ -32,21 +48,201 @@ func NewShowRepo(db *sqlx.DB) ShowRepo {
 }
 
 func (r ShowRepo) Add(ctx context.Context, show entity.Show) error {
-	_, err := r.db.ExecContext(ctx, `INSERT INTO shows
-		(show_id, dead_nation_id, number_of_tickets, start_time, title, venue)
-		VALUES ($1, $2, $3, $4, $5, $6);`,
-		show.ShowID, show.DeadNationID, show.NumberOfTickets, show.StartTime, show.Title, show.Venue)
-	return err
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	if err := addShow(ctx, tx, show); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func addShow(ctx context.Context, tx *sql.Tx, show entity.Show) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO shows
+		(show_id, dead_nation_id, number_of_tickets, start_time, title, venue, non_refundable)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);`,
+		show.ShowID, show.DeadNationID, show.NumberOfTickets, show.StartTime, show.Title, show.Venue, show.NonRefundable)
+	if err != nil {
+		return fmt.Errorf("inserting show: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO show_inventory (show_id, tickets_available) VALUES ($1, $2);`,
+		show.ShowID, show.NumberOfTickets)
+	if err != nil {
+		return fmt.Errorf("inserting show inventory: %w", err)
+	}
+
+	for _, c := range show.Categories {
+		_, err := tx.ExecContext(ctx, `INSERT INTO show_ticket_categories
+			(show_id, name, capacity, price_amount, price_currency, tickets_available)
+			VALUES ($1, $2, $3, $4, $5, $3);`,
+			show.ShowID, c.Name, c.Capacity, c.Price.Amount, c.Price.Currency)
+		if err != nil {
+			return fmt.Errorf("inserting ticket category %s: %w", c.Name, err)
+		}
+	}
+
+	return nil
 }
 
 func (r ShowRepo) Get(ctx context.Context, showID string) (entity.Show, error) {
-	row := r.db.QueryRowx(`SELECT show_id, dead_nation_id, number_of_tickets, start_time, title, venue
+	row := r.db.QueryRowx(`SELECT show_id, dead_nation_id, number_of_tickets, start_time, title, venue, non_refundable
 		FROM shows WHERE show_id = $1`, showID)
 
 	var s entity.Show
-	if err := row.Scan(&s.ShowID, &s.DeadNationID, &s.NumberOfTickets, &s.StartTime, &s.Title, &s.Venue); err != nil {
+	err := row.Scan(&s.ShowID, &s.DeadNationID, &s.NumberOfTickets, &s.StartTime, &s.Title, &s.Venue, &s.NonRefundable)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Show{}, showNotFoundError{showID: showID}
+	}
+	if err != nil {
 		return entity.Show{}, fmt.Errorf("scanning row: %w", err)
 	}
 
+	rows, err := r.db.QueryContext(ctx, `SELECT name, capacity, price_amount::text, price_currency
+		FROM show_ticket_categories
+		WHERE show_id = $1
+		ORDER BY price_amount, name`, showID)
+	if err != nil {
+		return entity.Show{}, fmt.Errorf("querying ticket categories: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c entity.TicketCategory
+		if err := rows.Scan(&c.Name, &c.Capacity, &c.Price.Amount, &c.Price.Currency); err != nil {
+			return entity.Show{}, fmt.Errorf("scanning ticket category: %w", err)
+		}
+		s.Categories = append(s.Categories, c)
+	}
+	if err := rows.Err(); err != nil {
+		return entity.Show{}, fmt.Errorf("iterating rows: %w", err)
+	}
+
 	return s, nil
 }
+
+func (r ShowRepo) GetAvailability(ctx context.Context, showID string) (entity.ShowAvailability, error) {
+	row := r.db.QueryRowxContext(ctx, showAvailabilityQuery+`
+		WHERE s.show_id = $1`, showID)
+
+	s, err := scanShowAvailability(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.ShowAvailability{}, showNotFoundError{showID: showID}
+	}
+	if err != nil {
+		return entity.ShowAvailability{}, fmt.Errorf("scanning row: %w", err)
+	}
+
+	shows := []entity.ShowAvailability{s}
+	if err := r.addCategories(ctx, shows); err != nil {
+		return entity.ShowAvailability{}, err
+	}
+
+	return shows[0], nil
+}
+
+func (r ShowRepo) List(ctx context.Context, filter entity.ShowFilter) ([]entity.ShowAvailability, error) {
+	var conditions []string
+	var args []any
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		conditions = append(conditions, fmt.Sprintf("s.start_time >= $%d", len(args)))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		conditions = append(conditions, fmt.Sprintf("s.start_time < $%d", len(args)))
+	}
+	if filter.Venue != "" {
+		args = append(args, filter.Venue)
+		conditions = append(conditions, fmt.Sprintf("s.venue = $%d", len(args)))
+	}
+
+	query := showAvailabilityQuery
+	if len(conditions) > 0 {
+		query += "\n\tWHERE " + strings.Join(conditions, " AND ")
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(`
+	ORDER BY s.start_time, s.show_id
+	LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+
+	rows, err := r.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying db: %w", err)
+	}
+	defer rows.Close()
+
+	shows := []entity.ShowAvailability{}
+	for rows.Next() {
+		s, err := scanShowAvailability(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+
+		shows = append(shows, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating rows: %w", err)
+	}
+
+	if err := r.addCategories(ctx, shows); err != nil {
+		return nil, err
+	}
+
+	return shows, nil
+}
+
+// addCategories loads the ticket categories of the shows. A category never
+// has more tickets available than its show as a whole.
+func (r ShowRepo) addCategories(ctx context.Context, shows []entity.ShowAvailability) error {
+	if len(shows) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*entity.ShowAvailability, len(shows))
+	showIDs := make([]string, 0, len(shows))
+	for i := range shows {
+		byID[shows[i].ShowID] = &shows[i]
+		showIDs = append(showIDs, shows[i].ShowID)
+	}
+
+	rows, err := r.db.QueryContext(ctx, categoryAvailabilityQuery+`
+		WHERE c.show_id = ANY($1)
+		ORDER BY c.price_amount, c.name`, pq.Array(showIDs))
+	if err != nil {
+		return fmt.Errorf("querying ticket categories: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			showID string
+			c      entity.TicketCategoryAvailability
+		)
+		err := rows.Scan(&showID, &c.Name, &c.Capacity, &c.Price.Amount, &c.Price.Currency, &c.TicketsAvailable)
+		if err != nil {
+			return fmt.Errorf("scanning ticket category: %w", err)
+		}
+
+		s := byID[showID]
+		c.TicketsAvailable = min(c.TicketsAvailable, s.TicketsAvailable)
+		s.Categories = append(s.Categories, c.TicketCategory)
+		s.CategoriesAvailable = append(s.CategoriesAvailable, c)
+	}
+
+	return rows.Err()
+}
+
+func scanShowAvailability(row interface{ Scan(dest ...any) error }) (entity.ShowAvailability, error) {
+	var s entity.ShowAvailability
+	err := row.Scan(&s.ShowID, &s.DeadNationID, &s.NumberOfTickets, &s.StartTime, &s.Title, &s.Venue, &s.NonRefundable, &s.TicketsAvailable)
+	return s, err
+}
@@ -0,0 +1,55 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"tickets/entity"
+	"tickets/postgres"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShowRepo_GetAvailability(t *testing.T) {
+	ctx := context.Background()
+	r := postgres.NewShowRepo(db)
+
+	show := entity.Show{
+		ShowID:          uuid.NewString(),
+		DeadNationID:    uuid.NewString(),
+		NumberOfTickets: 10,
+		StartTime:       time.Now().UTC().Truncate(time.Second),
+		Title:           "Test show",
+		Venue:           "Test venue " + uuid.NewString(),
+	}
+	require.NoError(t, r.Add(ctx, show))
+
+	bookingRepo := postgres.NewBookingRepo(db, newOutboxTxBus(t))
+	booking := entity.Booking{
+		BookingID:       uuid.NewString(),
+		ShowID:          show.ShowID,
+		NumberOfTickets: 3,
+		CustomerEmail:   "test@example.com",
+	}
+	require.NoError(t, bookingRepo.Add(ctx, booking))
+
+	canceled := booking
+	canceled.BookingID = uuid.NewString()
+	canceled.NumberOfTickets = 2
+	require.NoError(t, bookingRepo.Add(ctx, canceled))
+	require.NoError(t, bookingRepo.Cancel(ctx, canceled.BookingID))
+
+	availability, err := r.GetAvailability(ctx, show.ShowID)
+	require.NoError(t, err)
+	assert.Equal(t, show.ShowID, availability.ShowID)
+	assert.Equal(t, uint(10), availability.NumberOfTickets)
+	assert.Equal(t, uint(7), availability.TicketsAvailable)
+
+	shows, err := r.List(ctx, entity.ShowFilter{Venue: show.Venue, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, shows, 1)
+	assert.Equal(t, uint(7), shows[0].TicketsAvailable)
+}
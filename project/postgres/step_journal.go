@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// StepJournalRepo records the steps of multi-step command handlers that have
+// completed, so a redelivered command doesn't repeat their side effects.
+type StepJournalRepo struct {
+	db *sqlx.DB
+}
+
+func NewStepJournalRepo(db *sqlx.DB) StepJournalRepo {
+	return StepJournalRepo{
+		db: db,
+	}
+}
+
+// stepClaimTTL is how long a delivery owns a step before another delivery
+// may take it over.
+const stepClaimTTL = time.Minute
+
+// RunStep calls run unless the step already completed for the command with the
+// idempotency key. Like InboxRepo.ProcessOnce, it claims the step, runs it
+// without holding a transaction and then marks it completed. A delivery that
+// finds the step claimed waits for it to complete, or for the claim to expire.
+// A failed step is released, so it's run again on the next delivery.
+func (r StepJournalRepo) RunStep(ctx context.Context, commandName, idempotencyKey, step string, run func() error) error {
+	_, completed, err := waitForClaim(ctx, func() (bool, bool, error) {
+		return r.claim(ctx, commandName, idempotencyKey, step)
+	})
+	if err != nil {
+		return err
+	}
+	if completed {
+		return nil
+	}
+
+	if err := run(); err != nil {
+		return errors.Join(err, r.release(ctx, commandName, idempotencyKey, step))
+	}
+
+	_, err = r.db.ExecContext(ctx, `UPDATE command_steps SET completed_at = now()
+		WHERE command_name = $1 AND idempotency_key = $2 AND step = $3`, commandName, idempotencyKey, step)
+	if err != nil {
+		return fmt.Errorf("marking command step completed: %w", err)
+	}
+
+	return nil
+}
+
+func (r StepJournalRepo) claim(ctx context.Context, commandName, idempotencyKey, step string) (claimed, completed bool, err error) {
+	res, err := r.db.ExecContext(ctx, `INSERT INTO command_steps
+		(command_name, idempotency_key, step, claimed_until)
+		VALUES ($1, $2, $3, now() + $4 * interval '1 millisecond')
+		ON CONFLICT (command_name, idempotency_key, step) DO UPDATE
+		SET claimed_until = EXCLUDED.claimed_until
+		WHERE command_steps.completed_at IS NULL AND command_steps.claimed_until <= now()`,
+		commandName, idempotencyKey, step, stepClaimTTL.Milliseconds())
+	if err != nil {
+		return false, false, fmt.Errorf("claiming command step: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, false, fmt.Errorf("getting rows affected: %w", err)
+	}
+	if n == 1 {
+		return true, false, nil
+	}
+
+	err = r.db.GetContext(ctx, &completed, `SELECT completed_at IS NOT NULL FROM command_steps
+		WHERE command_name = $1 AND idempotency_key = $2 AND step = $3`, commandName, idempotencyKey, step)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("getting command step: %w", err)
+	}
+
+	return false, completed, nil
+}
+
+func (r StepJournalRepo) release(ctx context.Context, commandName, idempotencyKey, step string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM command_steps
+		WHERE command_name = $1 AND idempotency_key = $2 AND step = $3 AND completed_at IS NULL`,
+		commandName, idempotencyKey, step)
+	if err != nil {
+		return fmt.Errorf("releasing command step claim: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteCompletedBefore deletes steps completed before the time, along with
+// claims abandoned by deliveries that never came back.
+func (r StepJournalRepo) DeleteCompletedBefore(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM command_steps
+		WHERE completed_at < $1 OR (completed_at IS NULL AND claimed_until < $1)`, before)
+	if err != nil {
+		return 0, fmt.Errorf("executing delete query: %w", err)
+	}
+
+	return res.RowsAffected()
+}
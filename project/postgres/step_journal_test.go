@@ -0,0 +1,84 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tickets/postgres"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStepJournalRepo_RunStep(t *testing.T) {
+	ctx := context.Background()
+	r := postgres.NewStepJournalRepo(db)
+	idempotencyKey := uuid.NewString()
+
+	var refunds, voids int
+	refund := func() error {
+		refunds++
+		return nil
+	}
+
+	require.NoError(t, r.RunStep(ctx, "RefundTicket", idempotencyKey, "refund-payment", refund))
+	err := r.RunStep(ctx, "RefundTicket", idempotencyKey, "void-receipt", func() error {
+		voids++
+		return errors.New("failed")
+	})
+	require.Error(t, err)
+
+	require.NoError(t, r.RunStep(ctx, "RefundTicket", idempotencyKey, "refund-payment", refund))
+	require.NoError(t, r.RunStep(ctx, "RefundTicket", idempotencyKey, "void-receipt", func() error {
+		voids++
+		return nil
+	}))
+
+	assert.Equal(t, 1, refunds, "completed step should not run again")
+	assert.Equal(t, 2, voids, "failed step should run again")
+
+	require.NoError(t, r.RunStep(ctx, "RefundTicket", uuid.NewString(), "refund-payment", refund))
+	assert.Equal(t, 2, refunds)
+}
+
+func TestStepJournalRepo_RunStep_overlappingDeliveries(t *testing.T) {
+	ctx := context.Background()
+	r := postgres.NewStepJournalRepo(db)
+	idempotencyKey := uuid.NewString()
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	first := make(chan error, 1)
+	go func() {
+		first <- r.RunStep(ctx, "RefundTicket", idempotencyKey, "refund-payment", func() error {
+			close(started)
+			<-finish
+			return nil
+		})
+	}()
+	<-started
+
+	var secondRuns atomic.Int32
+	second := make(chan error, 1)
+	go func() {
+		second <- r.RunStep(ctx, "RefundTicket", idempotencyKey, "refund-payment", func() error {
+			secondRuns.Add(1)
+			return nil
+		})
+	}()
+
+	select {
+	case <-second:
+		t.Fatal("second delivery should wait for the step to complete")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	close(finish)
+	require.NoError(t, <-first)
+	require.NoError(t, <-second)
+	assert.Zero(t, secondRuns.Load(), "completed step should not run again")
+}
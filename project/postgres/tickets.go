@@ -2,21 +2,28 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"time"
+
 	"tickets/entity"
 
+	"github.com/ThreeDotsLabs/go-event-driven/common/log"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 )
 
-func CreateTicketsTable(ctx context.Context, db *sqlx.DB) error {
-	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS tickets (
-		ticket_id UUID PRIMARY KEY,
-		price_amount NUMERIC(10, 2) NOT NULL,
-		price_currency CHAR(3) NOT NULL,
-		customer_email VARCHAR(255) NOT NULL
-	);`)
-	return err
+type ticketNotFoundError struct {
+	ticketID string
+}
+
+func (e ticketNotFoundError) Error() string {
+	return fmt.Sprintf("ticket %s not found", e.ticketID)
+}
+
+func (e ticketNotFoundError) NotFound() bool {
+	return true
 }
 
 type TicketRepo struct {
@@ -29,33 +36,182 @@ func NewTicketRepo(db *sqlx.DB) TicketRepo {
 	}
 }
 
-func (r TicketRepo) Add(ctx context.Context, ticket entity.Ticket) error {
-	_, err := r.db.ExecContext(ctx, `INSERT INTO tickets
-		(ticket_id, price_amount, price_currency, customer_email)
-		VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING;`,
-		ticket.ID, ticket.Price.Amount, ticket.Price.Currency, ticket.CustomerEmail)
-	return err
+// Add stores the ticket as confirmed by an event published at publishedAt.
+func (r TicketRepo) Add(ctx context.Context, ticket entity.Ticket, publishedAt time.Time) error {
+	return r.store(ctx, ticket, entity.StatusConfirmed, publishedAt)
+}
+
+// Cancel stores the ticket as canceled by an event published at publishedAt.
+// The ticket is stored even if its confirmation hasn't been yet.
+func (r TicketRepo) Cancel(ctx context.Context, ticket entity.Ticket, publishedAt time.Time) error {
+	return r.store(ctx, ticket, entity.StatusCanceled, publishedAt)
+}
+
+func (r TicketRepo) store(ctx context.Context, ticket entity.Ticket, status string, publishedAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	if err := r.insertOrApply(ctx, tx, ticket, status, publishedAt); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
 }
 
-func (r TicketRepo) Delete(ctx context.Context, ticketID string) error {
-	res, err := r.db.ExecContext(ctx, "DELETE FROM tickets WHERE ticket_id = $1", ticketID)
+func (r TicketRepo) insertOrApply(ctx context.Context, tx *sql.Tx, ticket entity.Ticket, status string, publishedAt time.Time) error {
+	publishedAt = publishedAt.Round(time.Microsecond)
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO tickets
+		(ticket_id, booking_id, price_amount, price_currency, customer_email, status, last_event_at)
+		VALUES ($1, NULLIF($2, '')::uuid, $3, $4, $5, $6, $7) ON CONFLICT DO NOTHING;`,
+		ticket.ID, ticket.BookingID, ticket.Price.Amount, ticket.Price.Currency, ticket.CustomerEmail, status, publishedAt)
 	if err != nil {
-		return fmt.Errorf("executing delete query: %w", err)
+		return fmt.Errorf("inserting ticket: %w", err)
 	}
 
 	n, err := res.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("getting rows affected: %w", err)
 	}
-	if n != 1 {
-		return fmt.Errorf("unexpected exec result: %d rows affected", n)
+	if n == 1 {
+		return recordStatusChange(ctx, tx, ticket.ID, status)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE tickets
+		SET booking_id = NULLIF($2, '')::uuid, price_amount = $3, price_currency = $4, customer_email = $5,
+			placeholder = false, updated_at = now()
+		WHERE ticket_id = $1 AND placeholder`,
+		ticket.ID, ticket.BookingID, ticket.Price.Amount, ticket.Price.Currency, ticket.CustomerEmail)
+	if err != nil {
+		return fmt.Errorf("filling in ticket placeholder: %w", err)
+	}
+
+	return applyStatus(ctx, tx, ticket.ID, status, publishedAt)
+}
+
+// SetStatus moves the ticket to the status, such as printed or refunded, set
+// by an event published at publishedAt. If the ticket's confirmation hasn't
+// been stored yet, the status is kept on a placeholder row that the
+// confirmation fills in.
+func (r TicketRepo) SetStatus(ctx context.Context, ticketID, status string, publishedAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	if err := setStatus(ctx, tx, ticketID, status, publishedAt.Round(time.Microsecond)); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func setStatus(ctx context.Context, tx *sql.Tx, ticketID, status string, publishedAt time.Time) error {
+	res, err := tx.ExecContext(ctx, `INSERT INTO tickets
+		(ticket_id, price_amount, price_currency, customer_email, status, last_event_at, placeholder)
+		VALUES ($1, 0, '', '', $2, $3, true) ON CONFLICT DO NOTHING;`,
+		ticketID, status, publishedAt)
+	if err != nil {
+		return fmt.Errorf("inserting ticket placeholder: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting rows affected: %w", err)
+	}
+	if n == 1 {
+		return recordStatusChange(ctx, tx, ticketID, status)
+	}
+
+	return applyStatus(ctx, tx, ticketID, status, publishedAt)
+}
+
+// applyStatus sets the ticket's status unless a later event was already
+// applied. Ticket events are handled by separate consumer groups, so they can
+// arrive in any order; the publish time decides which one wins, except that
+// printing never overwrites a canceled or refunded ticket, however late it was
+// printed.
+func applyStatus(ctx context.Context, tx *sql.Tx, ticketID, status string, publishedAt time.Time) error {
+	var (
+		currentStatus string
+		lastEventAt   *time.Time
+	)
+	row := tx.QueryRowContext(ctx, `SELECT status, last_event_at FROM tickets WHERE ticket_id = $1 FOR UPDATE`, ticketID)
+	err := row.Scan(&currentStatus, &lastEventAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ticketNotFoundError{ticketID: ticketID}
+	}
+	if err != nil {
+		return fmt.Errorf("getting ticket: %w", err)
+	}
+
+	if lastEventAt != nil && !publishedAt.After(*lastEventAt) {
+		return nil
+	}
+	if status == entity.StatusPrinted && isFinalStatus(currentStatus) {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE tickets SET status = $2, last_event_at = $3, updated_at = now()
+		WHERE ticket_id = $1`, ticketID, status, publishedAt)
+	if err != nil {
+		return fmt.Errorf("updating ticket status: %w", err)
+	}
+
+	if currentStatus == status {
+		return nil
+	}
+
+	return recordStatusChange(ctx, tx, ticketID, status)
+}
+
+func isFinalStatus(status string) bool {
+	return status == entity.StatusCanceled || status == entity.StatusRefunded
+}
+
+// recordStatusChange appends the status to the ticket's history. Callers only
+// record actual changes, so redelivered events don't repeat entries.
+func recordStatusChange(ctx context.Context, tx *sql.Tx, ticketID, status string) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO ticket_status_history
+		(ticket_id, status, correlation_id)
+		VALUES ($1, $2, $3);`,
+		ticketID, status, log.CorrelationIDFromContext(ctx))
+	if err != nil {
+		return fmt.Errorf("inserting ticket status history: %w", err)
 	}
 
 	return nil
 }
 
+func (r TicketRepo) Get(ctx context.Context, ticketID string) (entity.Ticket, error) {
+	row := r.db.QueryRowxContext(ctx, `SELECT ticket_id, coalesce(booking_id::text, ''), price_amount, price_currency, customer_email, status
+		FROM tickets WHERE ticket_id = $1 AND NOT placeholder`, ticketID)
+
+	var t entity.Ticket
+	err := row.Scan(&t.ID, &t.BookingID, &t.Price.Amount, &t.Price.Currency, &t.CustomerEmail, &t.Status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Ticket{}, ticketNotFoundError{ticketID: ticketID}
+	}
+	if err != nil {
+		return entity.Ticket{}, fmt.Errorf("scanning row: %w", err)
+	}
+
+	return t, nil
+}
+
 func (r TicketRepo) List(ctx context.Context) ([]entity.Ticket, error) {
-	rows, err := r.db.QueryxContext(ctx, "SELECT ticket_id, price_amount, price_currency, customer_email FROM tickets")
+	rows, err := r.db.QueryxContext(ctx, `SELECT ticket_id, coalesce(booking_id::text, ''), price_amount, price_currency, customer_email, status
+		FROM tickets WHERE NOT placeholder`)
 	if err != nil {
 		return nil, fmt.Errorf("querying db: %w", err)
 	}
@@ -63,7 +219,7 @@ func (r TicketRepo) List(ctx context.Context) ([]entity.Ticket, error) {
 	var tickets []entity.Ticket
 	for rows.Next() {
 		var t entity.Ticket
-		if err := rows.Scan(&t.ID, &t.Price.Amount, &t.Price.Currency, &t.CustomerEmail); err != nil {
+		if err := rows.Scan(&t.ID, &t.BookingID, &t.Price.Amount, &t.Price.Currency, &t.CustomerEmail, &t.Status); err != nil {
 			return nil, fmt.Errorf("scanning row: %w", err)
 		}
 
@@ -72,3 +228,36 @@ func (r TicketRepo) List(ctx context.Context) ([]entity.Ticket, error) {
 
 	return tickets, nil
 }
+
+// History returns the ticket's status changes, oldest first.
+func (r TicketRepo) History(ctx context.Context, ticketID string) ([]entity.TicketStatusChange, error) {
+	var exists bool
+	err := r.db.GetContext(ctx, &exists, `SELECT EXISTS (SELECT 1 FROM tickets WHERE ticket_id = $1 AND NOT placeholder)`, ticketID)
+	if err != nil {
+		return nil, fmt.Errorf("checking ticket: %w", err)
+	}
+	if !exists {
+		return nil, ticketNotFoundError{ticketID: ticketID}
+	}
+
+	rows, err := r.db.QueryxContext(ctx, `SELECT status, correlation_id, changed_at
+		FROM ticket_status_history
+		WHERE ticket_id = $1
+		ORDER BY id`, ticketID)
+	if err != nil {
+		return nil, fmt.Errorf("querying db: %w", err)
+	}
+	defer rows.Close()
+
+	history := []entity.TicketStatusChange{}
+	for rows.Next() {
+		var c entity.TicketStatusChange
+		if err := rows.Scan(&c.Status, &c.CorrelationID, &c.ChangedAt); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+
+		history = append(history, c)
+	}
+
+	return history, rows.Err()
+}
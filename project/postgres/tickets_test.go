@@ -5,12 +5,18 @@ import (
 	"log"
 	"os"
 	"testing"
+	"time"
+
 	"tickets/entity"
+	"tickets/message"
 	"tickets/postgres"
 
+	commonLog "github.com/ThreeDotsLabs/go-event-driven/common/log"
+	"github.com/ThreeDotsLabs/watermill"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -25,8 +31,8 @@ func TestMain(m *testing.M) {
 		log.Fatalf("failed to connect to db: %s", err)
 	}
 
-	if err := postgres.CreateTicketsTable(context.Background(), db); err != nil {
-		log.Fatalf("failed to create tickets table: %s", err)
+	if err := postgres.Migrate(context.Background(), db); err != nil {
+		log.Fatalf("failed to migrate db: %s", err)
 	}
 
 	code := m.Run()
@@ -49,8 +55,9 @@ func TestTicketRepo_Add(t *testing.T) {
 		CustomerEmail: "test@example.com",
 	}
 	r := postgres.NewTicketRepo(db)
-	require.NoError(t, r.Add(ctx, ticket))
-	require.NoError(t, r.Add(ctx, ticket))
+	publishedAt := time.Now()
+	require.NoError(t, r.Add(ctx, ticket, publishedAt))
+	require.NoError(t, r.Add(ctx, ticket, publishedAt))
 
 	tickets, err := r.List(ctx)
 	require.NoError(t, err)
@@ -63,9 +70,168 @@ func TestTicketRepo_Add(t *testing.T) {
 	require.Len(t, matchingTickets, 1)
 }
 
+func TestTicketRepo_history(t *testing.T) {
+	ctx := commonLog.ContextWithCorrelationID(context.Background(), "test-correlation-id")
+	ticket := entity.Ticket{
+		ID: uuid.NewString(),
+		Price: entity.Money{
+			Amount:   "100",
+			Currency: "GBP",
+		},
+		CustomerEmail: "test@example.com",
+	}
+	r := postgres.NewTicketRepo(db)
+	confirmedAt := time.Now()
+	printedAt := confirmedAt.Add(time.Second)
+	canceledAt := confirmedAt.Add(time.Minute)
+	require.NoError(t, r.Add(ctx, ticket, confirmedAt))
+	require.NoError(t, r.SetStatus(ctx, ticket.ID, entity.StatusPrinted, printedAt))
+	require.NoError(t, r.SetStatus(ctx, ticket.ID, entity.StatusPrinted, printedAt))
+	require.NoError(t, r.Cancel(ctx, ticket, canceledAt))
+	require.NoError(t, r.Cancel(ctx, ticket, canceledAt))
+
+	tickets, err := r.List(ctx)
+	require.NoError(t, err)
+	for _, tt := range tickets {
+		if tt.ID == ticket.ID {
+			assert.Equal(t, entity.StatusCanceled, tt.Status)
+		}
+	}
+
+	history, err := r.History(ctx, ticket.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 3, "repeated status changes should be recorded once")
+	assert.Equal(t, entity.StatusConfirmed, history[0].Status)
+	assert.Equal(t, entity.StatusPrinted, history[1].Status)
+	assert.Equal(t, entity.StatusCanceled, history[2].Status)
+	assert.Equal(t, "test-correlation-id", history[2].CorrelationID)
+
+	_, err = r.History(ctx, uuid.NewString())
+	var notFoundErr interface{ NotFound() bool }
+	assert.ErrorAs(t, err, &notFoundErr)
+}
+
+func TestTicketRepo_outOfOrderEvents(t *testing.T) {
+	ctx := context.Background()
+	r := postgres.NewTicketRepo(db)
+
+	newTicket := func() entity.Ticket {
+		return entity.Ticket{
+			ID: uuid.NewString(),
+			Price: entity.Money{
+				Amount:   "100",
+				Currency: "GBP",
+			},
+			CustomerEmail: "test@example.com",
+		}
+	}
+
+	confirmedAt := time.Now()
+	printedAt := confirmedAt.Add(time.Second)
+	canceledAt := confirmedAt.Add(time.Minute)
+
+	t.Run("cancel before confirm", func(t *testing.T) {
+		ticket := newTicket()
+		require.NoError(t, r.Cancel(ctx, ticket, canceledAt))
+		require.NoError(t, r.Add(ctx, ticket, confirmedAt))
+
+		assertTicketStatus(t, r, ticket.ID, entity.StatusCanceled)
+	})
+
+	t.Run("print after cancel", func(t *testing.T) {
+		ticket := newTicket()
+		require.NoError(t, r.Add(ctx, ticket, confirmedAt))
+		require.NoError(t, r.Cancel(ctx, ticket, canceledAt))
+		require.NoError(t, r.SetStatus(ctx, ticket.ID, entity.StatusPrinted, printedAt))
+
+		assertTicketStatus(t, r, ticket.ID, entity.StatusCanceled)
+
+		history, err := r.History(ctx, ticket.ID)
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.Equal(t, entity.StatusConfirmed, history[0].Status)
+		assert.Equal(t, entity.StatusCanceled, history[1].Status)
+	})
+
+	t.Run("print published after cancel", func(t *testing.T) {
+		ticket := newTicket()
+		require.NoError(t, r.Add(ctx, ticket, confirmedAt))
+		require.NoError(t, r.Cancel(ctx, ticket, canceledAt))
+		require.NoError(t, r.SetStatus(ctx, ticket.ID, entity.StatusPrinted, canceledAt.Add(time.Second)))
+
+		assertTicketStatus(t, r, ticket.ID, entity.StatusCanceled)
+	})
+
+	t.Run("print published after refund", func(t *testing.T) {
+		ticket := newTicket()
+		require.NoError(t, r.Add(ctx, ticket, confirmedAt))
+		require.NoError(t, r.SetStatus(ctx, ticket.ID, entity.StatusRefunded, canceledAt))
+		require.NoError(t, r.SetStatus(ctx, ticket.ID, entity.StatusPrinted, canceledAt.Add(time.Second)))
+
+		assertTicketStatus(t, r, ticket.ID, entity.StatusRefunded)
+
+		history, err := r.History(ctx, ticket.ID)
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.Equal(t, entity.StatusRefunded, history[1].Status)
+	})
+
+	t.Run("confirm published after cancel", func(t *testing.T) {
+		ticket := newTicket()
+		require.NoError(t, r.Add(ctx, ticket, confirmedAt))
+		require.NoError(t, r.Cancel(ctx, ticket, canceledAt))
+		require.NoError(t, r.Add(ctx, ticket, canceledAt.Add(time.Second)))
+
+		assertTicketStatus(t, r, ticket.ID, entity.StatusConfirmed)
+	})
+
+	t.Run("print before confirm", func(t *testing.T) {
+		ticket := newTicket()
+		require.NoError(t, r.SetStatus(ctx, ticket.ID, entity.StatusPrinted, printedAt))
+
+		_, err := r.Get(ctx, ticket.ID)
+		var notFoundErr interface{ NotFound() bool }
+		require.ErrorAs(t, err, &notFoundErr, "ticket should not be listed before its confirmation")
+
+		require.NoError(t, r.Add(ctx, ticket, confirmedAt))
+
+		assertTicketStatus(t, r, ticket.ID, entity.StatusPrinted)
+
+		stored, err := r.Get(ctx, ticket.ID)
+		require.NoError(t, err)
+		assert.Equal(t, ticket.CustomerEmail, stored.CustomerEmail)
+		assert.Equal(t, ticket.Price.Currency, stored.Price.Currency)
+	})
+}
+
+func assertTicketStatus(t *testing.T, r postgres.TicketRepo, ticketID, status string) {
+	t.Helper()
+
+	tickets, err := r.List(context.Background())
+	require.NoError(t, err)
+
+	for _, ticket := range tickets {
+		if ticket.ID == ticketID {
+			assert.Equal(t, status, ticket.Status)
+			return
+		}
+	}
+
+	assert.Failf(t, "ticket not found", "ticket %s", ticketID)
+}
+
 func getEnvOrDefault(key string, defaultValue string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
 	}
 	return defaultValue
 }
+
+func newOutboxTxBus(t testing.TB) message.TxBus {
+	t.Helper()
+
+	txBus, err := message.NewOutboxTxBus(watermill.NopLogger{})
+	require.NoError(t, err)
+
+	return txBus
+}
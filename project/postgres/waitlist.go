@@ -0,0 +1,201 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"tickets/entity"
+	"tickets/message/event"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+type waitlistEntryNotFoundError struct {
+	entryID string
+}
+
+func (e waitlistEntryNotFoundError) Error() string {
+	return fmt.Sprintf("waitlist entry %s not found", e.entryID)
+}
+
+func (e waitlistEntryNotFoundError) NotFound() bool {
+	return true
+}
+
+type WaitlistRepo struct {
+	db       *sqlx.DB
+	bus      TxBus
+	claimTTL time.Duration
+}
+
+// NewWaitlistRepo creates a repo that holds offered seats for claimTTL.
+func NewWaitlistRepo(db *sqlx.DB, bus TxBus, claimTTL time.Duration) WaitlistRepo {
+	return WaitlistRepo{
+		db:       db,
+		bus:      bus,
+		claimTTL: claimTTL,
+	}
+}
+
+// Add queues the entry and offers it seats straight away if there are any.
+func (r WaitlistRepo) Add(ctx context.Context, entry entity.WaitlistEntry) error {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelSerializable,
+	})
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	if err := r.add(ctx, tx, entry); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r WaitlistRepo) add(ctx context.Context, tx *sql.Tx, entry entity.WaitlistEntry) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO waitlist_entries
+		(entry_id, show_id, customer_email, number_of_tickets, status)
+		VALUES ($1, $2, $3, $4, $5);`,
+		entry.EntryID, entry.ShowID, entry.CustomerEmail, entry.NumberOfTickets, entity.WaitlistWaiting)
+	if err != nil {
+		return fmt.Errorf("inserting waitlist entry: %w", err)
+	}
+
+	return r.offerSeats(ctx, tx, entry.ShowID)
+}
+
+func (r WaitlistRepo) Get(ctx context.Context, entryID string) (entity.WaitlistEntry, error) {
+	row := r.db.QueryRowxContext(ctx, `SELECT w.entry_id, w.show_id, w.customer_email, w.number_of_tickets, w.status,
+			coalesce(w.hold_id::text, ''), h.expires_at, w.created_at
+		FROM waitlist_entries w
+		LEFT JOIN seat_holds h ON h.hold_id = w.hold_id
+		WHERE w.entry_id = $1`, entryID)
+
+	var e entity.WaitlistEntry
+	err := row.Scan(&e.EntryID, &e.ShowID, &e.CustomerEmail, &e.NumberOfTickets, &e.Status, &e.HoldID, &e.ClaimExpiresAt, &e.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.WaitlistEntry{}, waitlistEntryNotFoundError{entryID: entryID}
+	}
+	if err != nil {
+		return entity.WaitlistEntry{}, fmt.Errorf("scanning row: %w", err)
+	}
+
+	return e, nil
+}
+
+// OfferSeats offers available seats of the show to waiting customers in the
+// order they joined. Offers whose claim expired are closed first, so their
+// seats go to the next customer.
+func (r WaitlistRepo) OfferSeats(ctx context.Context, showID string) error {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelSerializable,
+	})
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	if err := r.offerSeats(ctx, tx, showID); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ShowsWithOpenEntries lists shows with customers waiting for, or yet to
+// claim, an offer.
+func (r WaitlistRepo) ShowsWithOpenEntries(ctx context.Context) ([]string, error) {
+	var showIDs []string
+	err := r.db.SelectContext(ctx, &showIDs, `SELECT DISTINCT show_id FROM waitlist_entries
+		WHERE status IN ($1, $2)`, entity.WaitlistWaiting, entity.WaitlistOffered)
+	if err != nil {
+		return nil, fmt.Errorf("selecting shows: %w", err)
+	}
+
+	return showIDs, nil
+}
+
+func (r WaitlistRepo) offerSeats(ctx context.Context, tx *sql.Tx, showID string) error {
+	_, err := tx.ExecContext(ctx, `UPDATE waitlist_entries w
+		SET status = $2, updated_at = now()
+		FROM seat_holds h
+		WHERE h.hold_id = w.hold_id AND w.show_id = $1 AND w.status = $3
+			AND h.status <> $4 AND (h.status <> $5 OR h.expires_at <= now())`,
+		showID, entity.WaitlistExpired, entity.WaitlistOffered, entity.SeatHoldConfirmed, entity.SeatHoldActive)
+	if err != nil {
+		return fmt.Errorf("expiring unclaimed offers: %w", err)
+	}
+
+	for {
+		entry := entity.WaitlistEntry{ShowID: showID}
+		row := tx.QueryRowContext(ctx, `SELECT entry_id, customer_email, number_of_tickets
+			FROM waitlist_entries
+			WHERE show_id = $1 AND status = $2
+			ORDER BY position
+			LIMIT 1`, showID, entity.WaitlistWaiting)
+		err := row.Scan(&entry.EntryID, &entry.CustomerEmail, &entry.NumberOfTickets)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("getting next waitlist entry: %w", err)
+		}
+
+		// Seats go strictly in queue order: if the first customer's request
+		// doesn't fit, nobody behind them is offered seats either.
+		err = reserveTickets(ctx, tx, showID, entry.NumberOfTickets)
+		var notEnoughTicketsErr notEnoughTicketsError
+		if errors.As(err, &notEnoughTicketsErr) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := r.offer(ctx, tx, entry); err != nil {
+			return err
+		}
+	}
+}
+
+func (r WaitlistRepo) offer(ctx context.Context, tx *sql.Tx, entry entity.WaitlistEntry) error {
+	hold := entity.SeatHold{
+		HoldID:          uuid.NewString(),
+		ShowID:          entry.ShowID,
+		NumberOfTickets: entry.NumberOfTickets,
+		CustomerEmail:   entry.CustomerEmail,
+		ExpiresAt:       time.Now().Add(r.claimTTL).UTC(),
+	}
+	if err := insertSeatHold(ctx, tx, hold); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, `UPDATE waitlist_entries
+		SET status = $2, hold_id = $3, updated_at = now()
+		WHERE entry_id = $1`,
+		entry.EntryID, entity.WaitlistOffered, hold.HoldID)
+	if err != nil {
+		return fmt.Errorf("updating waitlist entry: %w", err)
+	}
+
+	e := event.NewWaitlistSeatOffered(hold.HoldID, entry, hold)
+
+	if err := r.bus.Publish(ctx, tx, e); err != nil {
+		return fmt.Errorf("publishing event in transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"tickets/entity"
+	"tickets/postgres"
+
+	watermillSQL "github.com/ThreeDotsLabs/watermill-sql/v2/pkg/sql"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingTxBus struct {
+	events []any
+}
+
+func (b *recordingTxBus) Publish(_ context.Context, _ watermillSQL.ContextExecutor, events ...any) error {
+	b.events = append(b.events, events...)
+	return nil
+}
+
+func (b *recordingTxBus) Send(_ context.Context, _ watermillSQL.ContextExecutor, _ any) error {
+	return nil
+}
+
+func TestWaitlistRepo_OfferSeats(t *testing.T) {
+	ctx := context.Background()
+	bus := &recordingTxBus{}
+	r := postgres.NewWaitlistRepo(db, bus, time.Minute)
+
+	show := entity.Show{
+		ShowID:          uuid.NewString(),
+		DeadNationID:    uuid.NewString(),
+		NumberOfTickets: 3,
+		StartTime:       time.Now().UTC().Truncate(time.Second),
+		Title:           "Test show",
+		Venue:           "Test venue",
+	}
+	require.NoError(t, postgres.NewShowRepo(db).Add(ctx, show))
+
+	bookingID := uuid.NewString()
+	_, err := db.ExecContext(ctx, `INSERT INTO bookings (booking_id, show_id, number_of_tickets, customer_email)
+		VALUES ($1, $2, 3, 'test@example.com')`, bookingID, show.ShowID)
+	require.NoError(t, err)
+
+	first := newWaitlistEntry(show.ShowID, 2)
+	second := newWaitlistEntry(show.ShowID, 1)
+	third := newWaitlistEntry(show.ShowID, 1)
+	for _, e := range []entity.WaitlistEntry{first, second, third} {
+		require.NoError(t, r.Add(ctx, e))
+	}
+	assert.Empty(t, bus.events, "no seats should be offered for a sold out show")
+
+	_, err = db.ExecContext(ctx, `UPDATE bookings SET canceled_at = now() WHERE booking_id = $1`, bookingID)
+	require.NoError(t, err)
+
+	require.NoError(t, r.OfferSeats(ctx, show.ShowID))
+	assert.Len(t, bus.events, 2)
+
+	for _, e := range []entity.WaitlistEntry{first, second} {
+		entry, err := r.Get(ctx, e.EntryID)
+		require.NoError(t, err)
+		assert.Equal(t, entity.WaitlistOffered, entry.Status)
+		assert.NotEmpty(t, entry.HoldID)
+		assert.NotNil(t, entry.ClaimExpiresAt)
+	}
+
+	entry, err := r.Get(ctx, third.EntryID)
+	require.NoError(t, err)
+	assert.Equal(t, entity.WaitlistWaiting, entry.Status)
+}
+
+func newWaitlistEntry(showID string, numberOfTickets uint) entity.WaitlistEntry {
+	return entity.WaitlistEntry{
+		EntryID:         uuid.NewString(),
+		ShowID:          showID,
+		CustomerEmail:   "test@example.com",
+		NumberOfTickets: numberOfTickets,
+	}
+}
@@ -0,0 +1,148 @@
+package refund
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tickets/entity"
+)
+
+const (
+	RuleNonRefundableShow = "non_refundable_show"
+	RuleCutoff            = "refund_cutoff"
+)
+
+// RejectedError names the rule that doesn't allow the refund.
+type RejectedError struct {
+	Rule   string
+	Reason string
+}
+
+func (e RejectedError) Error() string {
+	return fmt.Sprintf("refund rejected by %s: %s", e.Rule, e.Reason)
+}
+
+func (e RejectedError) RefundRejected() (rule, reason string) {
+	return e.Rule, e.Reason
+}
+
+// Tier refunds Percentage of the price for requests made within Within of the
+// show's start.
+type Tier struct {
+	Within     time.Duration
+	Percentage uint
+}
+
+// Policy decides whether, and how much of, a ticket is refunded. The zero
+// Policy refunds everything except tickets of non-refundable shows.
+type Policy struct {
+	// Cutoff stops refunds this long before the show starts.
+	Cutoff time.Duration
+	// Tiers are applied by the narrowest window the request falls in.
+	// Requests outside every tier are refunded in full.
+	Tiers []Tier
+}
+
+// NewPolicy validates the tiers and orders them from the narrowest window.
+func NewPolicy(cutoff time.Duration, tiers []Tier) (Policy, error) {
+	for _, t := range tiers {
+		if t.Percentage > 100 {
+			return Policy{}, fmt.Errorf("tier within %s: percentage %d exceeds 100", t.Within, t.Percentage)
+		}
+		if t.Within <= cutoff {
+			return Policy{}, fmt.Errorf("tier within %s is inside the %s cutoff", t.Within, cutoff)
+		}
+	}
+
+	sorted := append([]Tier(nil), tiers...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Within < sorted[j].Within
+	})
+
+	return Policy{Cutoff: cutoff, Tiers: sorted}, nil
+}
+
+// ParseTiers parses tiers written as comma-separated window=percentage pairs,
+// for example "168h=50,72h=25".
+func ParseTiers(s string) ([]Tier, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var tiers []Tier
+	for _, part := range strings.Split(s, ",") {
+		within, percentage, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("tier %q: expected window=percentage", part)
+		}
+
+		d, err := time.ParseDuration(within)
+		if err != nil {
+			return nil, fmt.Errorf("tier %q: %w", part, err)
+		}
+
+		p, err := strconv.ParseUint(percentage, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("tier %q: %w", part, err)
+		}
+
+		tiers = append(tiers, Tier{Within: d, Percentage: uint(p)})
+	}
+
+	return tiers, nil
+}
+
+// Amount returns how much of the ticket's price is refunded when requested at
+// now, or RejectedError if no refund is allowed. Tickets not booked for a
+// known show are refunded in full.
+func (p Policy) Amount(ticket entity.Ticket, show *entity.Show, now time.Time) (entity.Money, error) {
+	if show == nil {
+		return ticket.Price, nil
+	}
+
+	if show.NonRefundable {
+		return entity.Money{}, RejectedError{
+			Rule:   RuleNonRefundableShow,
+			Reason: "tickets for this show are non-refundable",
+		}
+	}
+
+	notice := show.StartTime.Sub(now)
+	if notice < p.Cutoff {
+		return entity.Money{}, RejectedError{
+			Rule:   RuleCutoff,
+			Reason: fmt.Sprintf("refunds close %s before the show starts", p.Cutoff),
+		}
+	}
+
+	for _, t := range p.Tiers {
+		if notice < t.Within {
+			return percentageOf(ticket.Price, t.Percentage)
+		}
+	}
+
+	return ticket.Price, nil
+}
+
+func percentageOf(price entity.Money, percentage uint) (entity.Money, error) {
+	if percentage == 100 {
+		return price, nil
+	}
+
+	amount, ok := new(big.Rat).SetString(price.Amount)
+	if !ok {
+		return entity.Money{}, errors.New("invalid ticket price " + price.Amount)
+	}
+
+	amount.Mul(amount, big.NewRat(int64(percentage), 100))
+
+	return entity.Money{
+		Amount:   amount.FloatString(2),
+		Currency: price.Currency,
+	}, nil
+}
@@ -0,0 +1,90 @@
+package refund_test
+
+import (
+	"testing"
+	"time"
+
+	"tickets/entity"
+	"tickets/refund"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Amount(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	ticket := entity.Ticket{
+		ID:    "ticket",
+		Price: entity.Money{Amount: "42.50", Currency: "EUR"},
+	}
+
+	tiers, err := refund.ParseTiers("168h=75, 72h=50")
+	require.NoError(t, err)
+
+	policy, err := refund.NewPolicy(24*time.Hour, tiers)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		show         *entity.Show
+		expectedRule string
+		expected     string
+	}{
+		{
+			name:     "no show",
+			expected: "42.50",
+		},
+		{
+			name:     "outside tiers",
+			show:     &entity.Show{StartTime: now.Add(30 * 24 * time.Hour)},
+			expected: "42.50",
+		},
+		{
+			name:     "within widest tier",
+			show:     &entity.Show{StartTime: now.Add(100 * time.Hour)},
+			expected: "31.88",
+		},
+		{
+			name:     "within narrowest tier",
+			show:     &entity.Show{StartTime: now.Add(48 * time.Hour)},
+			expected: "21.25",
+		},
+		{
+			name:         "within cutoff",
+			show:         &entity.Show{StartTime: now.Add(time.Hour)},
+			expectedRule: refund.RuleCutoff,
+		},
+		{
+			name:         "non-refundable show",
+			show:         &entity.Show{StartTime: now.Add(30 * 24 * time.Hour), NonRefundable: true},
+			expectedRule: refund.RuleNonRefundableShow,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			amount, err := policy.Amount(ticket, tc.show, now)
+
+			if tc.expectedRule != "" {
+				var rejectedErr refund.RejectedError
+				require.ErrorAs(t, err, &rejectedErr)
+				assert.Equal(t, tc.expectedRule, rejectedErr.Rule)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, entity.Money{Amount: tc.expected, Currency: "EUR"}, amount)
+		})
+	}
+}
+
+func TestNewPolicy_invalidTiers(t *testing.T) {
+	_, err := refund.NewPolicy(24*time.Hour, []refund.Tier{{Within: 48 * time.Hour, Percentage: 120}})
+	assert.Error(t, err)
+
+	_, err = refund.NewPolicy(24*time.Hour, []refund.Tier{{Within: 12 * time.Hour, Percentage: 50}})
+	assert.Error(t, err)
+
+	_, err = refund.ParseTiers("72h")
+	assert.Error(t, err)
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	inboxRetention       = 7 * 24 * time.Hour
+	inboxCleanupInterval = time.Hour
+
+	// Commands are retried for far less than this, so older steps won't be
+	// looked up again.
+	stepJournalRetention       = 2 * 24 * time.Hour
+	stepJournalCleanupInterval = 6 * time.Hour
+
+	defaultSeatHoldTTL     = 10 * time.Minute
+	seatHoldExpiryInterval = 15 * time.Second
+	waitlistOfferInterval  = 30 * time.Second
+)
+
+// runPeriodically calls job every interval until ctx is done. Failures are
+// logged and retried on the next tick rather than stopping the service.
+func runPeriodically(ctx context.Context, name string, interval time.Duration, job func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := job(ctx); err != nil {
+				logrus.WithError(err).WithField("job", name).Error("Periodic job failed")
+			}
+		}
+	}
+}
+
+func (s Service) cleanUpInbox(ctx context.Context) error {
+	n, err := s.inboxRepo.DeleteProcessedBefore(ctx, time.Now().Add(-inboxRetention))
+	if err != nil {
+		return err
+	}
+
+	logrus.WithField("deleted", n).Debug("Cleaned up processed messages inbox")
+
+	return nil
+}
+
+func (s Service) cleanUpStepJournal(ctx context.Context) error {
+	n, err := s.stepJournal.DeleteCompletedBefore(ctx, time.Now().Add(-stepJournalRetention))
+	if err != nil {
+		return err
+	}
+
+	logrus.WithField("deleted", n).Debug("Cleaned up command step journal")
+
+	return nil
+}
+
+func (s Service) releaseExpiredSeatHolds(ctx context.Context) error {
+	n, err := s.seatHoldRepo.ReleaseExpired(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		logrus.WithField("released", n).Info("Released expired seat holds")
+	}
+
+	return nil
+}
+
+// offerWaitlistSeats catches seats freed without an event, like expired holds
+// and unclaimed offers, and offers them to the next waiting customers.
+func (s Service) offerWaitlistSeats(ctx context.Context) error {
+	showIDs, err := s.waitlistRepo.ShowsWithOpenEntries(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, showID := range showIDs {
+		if err := s.waitlistRepo.OfferSeats(ctx, showID); err != nil {
+			errs = append(errs, fmt.Errorf("offering seats of show %s: %w", showID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -6,18 +6,18 @@ import (
 	"fmt"
 	"time"
 
+	"tickets/broker"
 	"tickets/http"
 	"tickets/message"
 	"tickets/message/command"
 	"tickets/message/event"
 	"tickets/postgres"
+	"tickets/refund"
 
 	"github.com/ThreeDotsLabs/go-event-driven/common/log"
 	"github.com/ThreeDotsLabs/watermill"
-	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
-	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
 )
@@ -28,83 +28,139 @@ type ReceiptsClient interface {
 }
 
 type Deps struct {
+	Broker             broker.Broker
 	DB                 *sqlx.DB
 	DeadNationBooker   event.DeadNationBooker
 	Logger             watermill.LoggerAdapter
 	PaymentsClient     command.PaymentsClient
 	ReceiptsClient     ReceiptsClient
-	RedisClient        *redis.Client
 	SpreadsheetsClient event.SpreadsheetAppender
 	FilesClient        event.TicketGenerator
+	SkipMigrations     bool
+	SeatHoldTTL        time.Duration
+	RefundPolicy       refund.Policy
 }
 
 type Service struct {
-	db           *sqlx.DB
-	msgForwarder *message.Forwarder
-	msgRouter    *message.Router
-	httpRouter   *echo.Echo
+	db             *sqlx.DB
+	skipMigrations bool
+	inboxRepo      postgres.InboxRepo
+	seatHoldRepo   postgres.SeatHoldRepo
+	stepJournal    postgres.StepJournalRepo
+	waitlistRepo   postgres.WaitlistRepo
+	msgForwarder   *message.Forwarder
+	msgRouter      *message.Router
+	httpRouter     *echo.Echo
 }
 
 func New(deps Deps) (*Service, error) {
-	publisher, err := redisstream.NewPublisher(redisstream.PublisherConfig{
-		Client: deps.RedisClient,
-	}, deps.Logger)
-	if err != nil {
-		return nil, fmt.Errorf("creating publisher: %w", err)
+	decoratedPublisher := log.CorrelationPublisherDecorator{
+		Publisher: message.TracingPublisherDecorator{Publisher: deps.Broker.Publisher(), SpanName: "publish"},
 	}
-	decoratedPublisher := log.CorrelationPublisherDecorator{Publisher: publisher}
 
 	eventBus, err := event.NewBus(decoratedPublisher, deps.Logger)
 	if err != nil {
 		return nil, fmt.Errorf("creating event bus: %w", err)
 	}
 
-	commandBus, err := command.NewBus(decoratedPublisher, deps.Logger)
+	// With Postgres as the broker, events published in a transaction go straight
+	// to their topics and there is nothing to forward.
+	_, sqlBroker := deps.Broker.(*broker.SQL)
+	newTxBus := message.NewOutboxTxBus
+	if sqlBroker {
+		newTxBus = message.NewDirectTxBus
+	}
+	txBus, err := newTxBus(deps.Logger)
 	if err != nil {
-		return nil, fmt.Errorf("creating command bus: %w", err)
+		return nil, fmt.Errorf("creating transactional bus: %w", err)
+	}
+
+	seatHoldTTL := deps.SeatHoldTTL
+	if seatHoldTTL == 0 {
+		seatHoldTTL = defaultSeatHoldTTL
 	}
 
-	bookingRepo := postgres.NewBookingRepo(deps.DB)
+	blocklistRepo := postgres.NewBlocklistRepo(deps.DB)
+	bookingRepo := postgres.NewBookingRepo(deps.DB, txBus)
+	bookingSagaRepo := postgres.NewBookingSagaRepo(deps.DB, txBus)
+	eventStoreRepo := postgres.NewEventStoreRepo(deps.DB)
+	inboxRepo := postgres.NewInboxRepo(deps.DB)
+	outboxRepo := postgres.NewOutboxRepo(deps.DB, txBus)
+	promoCodeRepo := postgres.NewPromoCodeRepo(deps.DB)
+	refundRepo := postgres.NewRefundRepo(deps.DB, txBus)
+	seatHoldRepo := postgres.NewSeatHoldRepo(deps.DB, txBus)
 	showRepo := postgres.NewShowRepo(deps.DB)
+	stepJournalRepo := postgres.NewStepJournalRepo(deps.DB)
 	ticketRepo := postgres.NewTicketRepo(deps.DB)
-
-	cmdProcessorConfig := command.NewProcessorConfig(deps.Logger, deps.RedisClient)
-	cmdHandler := command.NewHandler(deps.PaymentsClient, deps.ReceiptsClient)
-
-	eventProcessorConfig := event.NewProcessorConfig(deps.Logger, deps.RedisClient)
-	eventHandler := event.NewHandler(deps.DeadNationBooker, eventBus, deps.ReceiptsClient, showRepo, deps.SpreadsheetsClient, deps.FilesClient, ticketRepo)
-
-	msgRouter, err := message.NewRouter(cmdHandler, cmdProcessorConfig, eventHandler, eventProcessorConfig, deps.Logger)
+	waitlistRepo := postgres.NewWaitlistRepo(deps.DB, txBus, seatHoldTTL)
+
+	cmdProcessorConfig := command.NewProcessorConfig(deps.Logger, deps.Broker)
+	cmdHandler := command.NewHandler(deps.PaymentsClient, deps.ReceiptsClient, refundRepo, stepJournalRepo)
+
+	eventProcessorConfig := event.NewProcessorConfig(deps.Logger, deps.Broker)
+	eventHandler := event.NewHandler(bookingRepo, bookingSagaRepo, deps.DeadNationBooker, eventBus, deps.ReceiptsClient, showRepo, deps.SpreadsheetsClient, deps.FilesClient, ticketRepo, waitlistRepo)
+
+	msgRouter, err := message.NewRouter(message.RouterDeps{
+		Blocklist:              blocklistRepo,
+		CommandHandler:         cmdHandler,
+		CommandProcessorConfig: cmdProcessorConfig,
+		EventHandler:           eventHandler,
+		EventProcessorConfig:   eventProcessorConfig,
+		EventStore:             eventStoreRepo,
+		Inbox:                  inboxRepo,
+		Logger:                 deps.Logger,
+		PoisonQueuePublisher:   decoratedPublisher,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("creating message router: %w", err)
 	}
 
-	msgForwarder, err := message.NewForwarder(deps.DB, deps.RedisClient, deps.Logger)
-	if err != nil {
-		return nil, fmt.Errorf("creating message forwarder: %w", err)
+	var msgForwarder *message.Forwarder
+	if !sqlBroker {
+		msgForwarder, err = message.NewForwarder(deps.DB, deps.Broker.Publisher(), deps.Logger)
+		if err != nil {
+			return nil, fmt.Errorf("creating message forwarder: %w", err)
+		}
 	}
 
+	deadLetterQueue := message.NewDeadLetterQueue(deps.Broker, decoratedPublisher)
+
 	httpRouter := http.NewRouter(http.RouterDeps{
-		BookingRepo:    bookingRepo,
-		CommandSender:  commandBus,
-		DB:             deps.DB,
-		EventPublisher: eventBus,
-		Logger:         deps.Logger,
-		ShowRepo:       showRepo,
-		TicketRepo:     ticketRepo,
+		BlocklistRepo:   blocklistRepo,
+		BookingRepo:     bookingRepo,
+		BookingSagaRepo: bookingSagaRepo,
+		DB:              deps.DB,
+		DeadLetterQueue: deadLetterQueue,
+		EventPublisher:  outboxRepo,
+		Logger:          deps.Logger,
+		PromoCodeRepo:   promoCodeRepo,
+		RefundPolicy:    deps.RefundPolicy,
+		RefundRepo:      refundRepo,
+		SeatHoldRepo:    seatHoldRepo,
+		SeatHoldTTL:     seatHoldTTL,
+		ShowRepo:        showRepo,
+		TicketRepo:      ticketRepo,
+		WaitlistRepo:    waitlistRepo,
 	})
 
 	return &Service{
-		db:           deps.DB,
-		msgForwarder: msgForwarder,
-		msgRouter:    msgRouter,
-		httpRouter:   httpRouter,
+		db:             deps.DB,
+		skipMigrations: deps.SkipMigrations,
+		inboxRepo:      inboxRepo,
+		seatHoldRepo:   seatHoldRepo,
+		stepJournal:    stepJournalRepo,
+		waitlistRepo:   waitlistRepo,
+		msgForwarder:   msgForwarder,
+		msgRouter:      msgRouter,
+		httpRouter:     httpRouter,
 	}, nil
 }
 
 func (s Service) Run(ctx context.Context) error {
-	if err := postgres.InitialiseDB(ctx, s.db); err != nil {
-		return fmt.Errorf("initialising db: %w", err)
+	if !s.skipMigrations {
+		if err := postgres.Migrate(ctx, s.db); err != nil {
+			return fmt.Errorf("migrating db: %w", err)
+		}
 	}
 
 	g, runCtx := errgroup.WithContext(ctx)
@@ -117,10 +173,36 @@ func (s Service) Run(ctx context.Context) error {
 		return nil
 	})
 
+	if s.msgForwarder != nil {
+		g.Go(func() error {
+			if err := s.msgForwarder.Run(runCtx); err != nil {
+				return fmt.Errorf("running message forwarder: %w", err)
+			}
+
+			return nil
+		})
+	}
+
 	g.Go(func() error {
-		if err := s.msgForwarder.Run(runCtx); err != nil {
-			return fmt.Errorf("running message forwarder: %w", err)
-		}
+		runPeriodically(runCtx, "inbox-cleanup", inboxCleanupInterval, s.cleanUpInbox)
+
+		return nil
+	})
+
+	g.Go(func() error {
+		runPeriodically(runCtx, "step-journal-cleanup", stepJournalCleanupInterval, s.cleanUpStepJournal)
+
+		return nil
+	})
+
+	g.Go(func() error {
+		runPeriodically(runCtx, "seat-hold-expiry", seatHoldExpiryInterval, s.releaseExpiredSeatHolds)
+
+		return nil
+	})
+
+	g.Go(func() error {
+		runPeriodically(runCtx, "waitlist-offers", waitlistOfferInterval, s.offerWaitlistSeats)
 
 		return nil
 	})
@@ -128,7 +210,9 @@ func (s Service) Run(ctx context.Context) error {
 	g.Go(func() error {
 		// Wait for message components
 		<-s.msgRouter.Running()
-		<-s.msgForwarder.Running()
+		if s.msgForwarder != nil {
+			<-s.msgForwarder.Running()
+		}
 
 		logrus.Info("starting http server...")
 		err := s.httpRouter.Start(":8080")
@@ -2,16 +2,21 @@ package tests_test
 
 import (
 	"testing"
+	"time"
 
+	"tickets/entity"
+	"tickets/refund"
 	"tickets/service"
 
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestComponent(t *testing.T) {
+	spanExporter := setupTracing(t)
 	db := setupDB(t)
-	redisClient := setupRedis(t)
+	messageBroker := setupBroker(t, db)
 	deadNationBooker := &MockDeadNationBooker{}
 	receiptsClient := &MockReceiptsClient{}
 	spreadsheetAppender := &MockSpreadsheetAppender{}
@@ -19,14 +24,19 @@ func TestComponent(t *testing.T) {
 	ticketRefunder := &MockTicketRefunder{}
 
 	deps := service.Deps{
+		Broker:             messageBroker,
 		DB:                 db,
 		Logger:             watermill.NewStdLogger(false, false),
-		RedisClient:        redisClient,
 		DeadNationBooker:   deadNationBooker,
 		ReceiptsClient:     receiptsClient,
 		SpreadsheetsClient: spreadsheetAppender,
 		FilesClient:        ticketGenerator,
 		PaymentsClient:     ticketRefunder,
+		// Shows created by the tests start within a day, so their tickets
+		// are only half refundable.
+		RefundPolicy: refund.Policy{
+			Tiers: []refund.Tier{{Within: 48 * time.Hour, Percentage: 50}},
+		},
 	}
 	startService(t, deps)
 
@@ -54,7 +64,9 @@ func TestComponent(t *testing.T) {
 		assertTicketToPrintRowForTicketAppended(t, spreadsheetAppender, ticket)
 		assertStoredTicketInDB(t, db, ticket)
 		assertTicketGenerated(t, ticketGenerator, ticket)
-		assertTicketPrintedEventPublished(t, redisClient, ticket)
+		assertTicketPrintedEventPublished(t, messageBroker, ticket)
+		assertHandlerSpanInRequestTrace(t, spanExporter, "POST /tickets-status", "handle issue-receipt")
+		assertMetricExported(t, `tickets_messages_processed_total{handler="issue-receipt"}`)
 	})
 
 	t.Run("canceled ticket", func(t *testing.T) {
@@ -76,4 +88,121 @@ func TestComponent(t *testing.T) {
 		sendTicketsStatus(t, req, uuid.NewString())
 		assertTicketToRefundRowForTicketAppended(t, spreadsheetAppender, ticket)
 	})
+	t.Run("refunded ticket", func(t *testing.T) {
+		ticket := TicketStatus{
+			TicketID:      uuid.NewString(),
+			Status:        "confirmed",
+			CustomerEmail: "someone@example.com",
+			Price: Money{
+				Amount:   "42.00",
+				Currency: "GBP",
+			},
+		}
+
+		sendTicketsStatus(t, TicketsStatusRequest{Tickets: []TicketStatus{ticket}}, uuid.NewString())
+		assertStoredTicketInDB(t, db, ticket)
+
+		refundID := refundTicket(t, ticket.TicketID)
+		assertRefundStatus(t, refundID, "receipt_voided")
+	})
+
+	t.Run("partial refund", func(t *testing.T) {
+		showID := createShow(t, uuid.NewString(), 10)
+		bookingID := bookTickets(t, showID, 1)
+
+		ticket := TicketStatus{
+			TicketID:      uuid.NewString(),
+			Status:        "confirmed",
+			CustomerEmail: "someone@example.com",
+			BookingID:     bookingID,
+			Price: Money{
+				Amount:   "42.00",
+				Currency: "GBP",
+			},
+		}
+
+		sendTicketsStatus(t, TicketsStatusRequest{Tickets: []TicketStatus{ticket}}, uuid.NewString())
+		assertStoredTicketInDB(t, db, ticket)
+
+		idempotencyKey := uuid.NewString()
+		refundID := refundTicketWithKey(t, ticket.TicketID, idempotencyKey)
+		assertRefundStatus(t, refundID, "receipt_voided")
+		assertPaymentRefunded(t, ticketRefunder, ticket.TicketID, &entity.Money{Amount: "21.00", Currency: "GBP"})
+
+		assert.Equal(t, refundID, refundTicketWithKey(t, ticket.TicketID, idempotencyKey), "retried request should return the same refund")
+	})
+
+	t.Run("refund rejected by policy", func(t *testing.T) {
+		showID := createNonRefundableShow(t, uuid.NewString(), 10)
+		bookingID := bookTickets(t, showID, 1)
+
+		ticket := TicketStatus{
+			TicketID:      uuid.NewString(),
+			Status:        "confirmed",
+			CustomerEmail: "someone@example.com",
+			BookingID:     bookingID,
+			Price: Money{
+				Amount:   "42.00",
+				Currency: "GBP",
+			},
+		}
+
+		sendTicketsStatus(t, TicketsStatusRequest{Tickets: []TicketStatus{ticket}}, uuid.NewString())
+		assertStoredTicketInDB(t, db, ticket)
+
+		rule := refundTicketRejected(t, ticket.TicketID)
+		assert.Equal(t, "non_refundable_show", rule)
+	})
+
+	t.Run("dead letter", func(t *testing.T) {
+		deadLetterID := addDeadLetter(t, messageBroker, "events.TicketBookingConfirmed", "print-ticket")
+
+		assertDeadLetterListed(t, deadLetterID)
+		discardDeadLetter(t, deadLetterID)
+		assertDeadLetterNotFound(t, deadLetterID)
+	})
+
+	t.Run("booking rejected by dead nation", func(t *testing.T) {
+		deadNationID := uuid.NewString()
+		deadNationBooker.Reject(deadNationID)
+
+		showID := createShow(t, deadNationID, 10)
+		bookingID := bookTickets(t, showID, 4)
+
+		assertBookingSagaStatus(t, bookingID, "failed")
+	})
+
+	t.Run("canceled booking", func(t *testing.T) {
+		showID := createShow(t, uuid.NewString(), 10)
+		bookingID := bookTickets(t, showID, 4)
+		assertTicketsAvailable(t, showID, 6)
+
+		cancelBooking(t, bookingID)
+		assertTicketsAvailable(t, showID, 10)
+		assertDeadNationCancellationAppended(t, spreadsheetAppender, bookingID)
+	})
+
+	t.Run("seat hold confirmed", func(t *testing.T) {
+		showID := createShow(t, uuid.NewString(), 5)
+		holdID := holdSeats(t, showID, 3)
+		assertTicketsAvailable(t, showID, 2)
+
+		bookingID := confirmSeatHold(t, holdID)
+		assert.Equal(t, bookingID, confirmSeatHold(t, holdID), "confirming twice should return the same booking")
+		assertTicketsAvailable(t, showID, 2)
+		assertBookingSagaStatus(t, bookingID, "confirmed")
+	})
+
+	t.Run("waitlist offered seats of canceled booking", func(t *testing.T) {
+		showID := createShow(t, uuid.NewString(), 2)
+		bookingID := bookTickets(t, showID, 2)
+		entryID := joinWaitlist(t, showID, 2)
+		assertWaitlistEntryStatus(t, entryID, "waiting")
+
+		cancelBooking(t, bookingID)
+		holdID := assertWaitlistEntryStatus(t, entryID, "offered")
+
+		confirmSeatHold(t, holdID)
+		assertWaitlistEntryStatus(t, entryID, "claimed")
+	})
 }
@@ -5,19 +5,30 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"testing"
 	"time"
 
+	"tickets/broker"
+	"tickets/entity"
 	"tickets/service"
 
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"github.com/lithammer/shortuuid/v3"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func getEnvOrDefault(key string, defaultValue string) string {
@@ -27,16 +38,43 @@ func getEnvOrDefault(key string, defaultValue string) string {
 	return defaultValue
 }
 
-func setupRedis(t *testing.T) *redis.Client {
-	addr := getEnvOrDefault("REDIS_ADDR", "localhost:6379")
+func setupTracing(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		assert.NoError(t, tp.Shutdown(context.Background()))
+	})
+
+	return exporter
+}
+
+// setupBroker runs the service on the in-memory broker unless MESSAGE_BROKER
+// is set to redis or postgres.
+func setupBroker(t *testing.T, db *sqlx.DB) broker.Broker {
+	switch os.Getenv("MESSAGE_BROKER") {
+	case "redis":
+	case "postgres":
+		b, err := broker.NewSQL(db, watermill.NewStdLogger(false, false))
+		require.NoError(t, err)
+
+		return b
+	default:
+		return broker.NewMemory()
+	}
+
 	c := redis.NewClient(&redis.Options{
-		Addr: addr,
+		Addr: getEnvOrDefault("REDIS_ADDR", "localhost:6379"),
 	})
 	t.Cleanup(func() {
-		assert.NoError(t, c.Conn().Close())
+		assert.NoError(t, c.Close())
 	})
 
-	return c
+	b, err := broker.NewRedis(c, watermill.NewStdLogger(false, false))
+	require.NoError(t, err)
+
+	return b
 }
 
 func setupDB(t *testing.T) *sqlx.DB {
@@ -239,28 +277,20 @@ type TicketPrinted struct {
 	FileName string `json:"file_name"`
 }
 
-func assertTicketPrintedEventPublished(t *testing.T, redisClient *redis.Client, ticket TicketStatus) {
+func assertTicketPrintedEventPublished(t *testing.T, b broker.Broker, ticket TicketStatus) {
 	t.Helper()
 
 	assert.EventuallyWithT(
 		t,
 		func(c *assert.CollectT) {
-			res, err := redisClient.XRead(context.Background(), &redis.XReadArgs{
-				Streams: []string{"events.TicketPrinted", "0"},
-				Count:   100,
-			}).Result()
+			messages, err := b.Messages(context.Background(), "events.TicketPrinted")
 			require.NoError(c, err)
-
-			require.Len(c, res, 1)
-			require.NotEmpty(c, res[0].Messages)
+			require.NotEmpty(c, messages)
 
 			var match bool
-			for _, m := range res[0].Messages {
-				payload, ok := m.Values["payload"].(string)
-				require.True(c, ok)
-
+			for _, m := range messages {
 				var actual TicketPrinted
-				err = json.Unmarshal([]byte(payload), &actual)
+				err = json.Unmarshal(m.Message.Payload, &actual)
 				require.NoError(c, err)
 
 				if actual.TicketID != ticket.TicketID {
@@ -278,3 +308,428 @@ func assertTicketPrintedEventPublished(t *testing.T, redisClient *redis.Client,
 		10*time.Millisecond,
 	)
 }
+
+type DeadLetter struct {
+	ID      string `json:"id"`
+	Handler string `json:"handler"`
+	Topic   string `json:"topic"`
+	Error   string `json:"error"`
+}
+
+func addDeadLetter(t *testing.T, b broker.Broker, topic, handler string) string {
+	t.Helper()
+
+	msg := message.NewMessage(uuid.NewString(), []byte(`{}`))
+	msg.Metadata.Set(middleware.ReasonForPoisonedKey, "test error")
+	msg.Metadata.Set(middleware.PoisonedTopicKey, topic)
+	msg.Metadata.Set(middleware.PoisonedHandlerKey, handler)
+
+	require.NoError(t, b.Publisher().Publish("dead_letter_queue", msg))
+
+	messages, err := b.Messages(context.Background(), "dead_letter_queue")
+	require.NoError(t, err)
+
+	for _, m := range messages {
+		if m.Message.UUID == msg.UUID {
+			return m.ID
+		}
+	}
+
+	require.FailNow(t, "dead letter not stored")
+
+	return ""
+}
+
+func assertDeadLetterListed(t *testing.T, deadLetterID string) {
+	t.Helper()
+
+	resp, err := http.Get("http://localhost:8080/dead-letters")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var deadLetters []DeadLetter
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&deadLetters))
+
+	var match bool
+	for _, dl := range deadLetters {
+		if dl.ID == deadLetterID {
+			match = true
+		}
+	}
+	assert.True(t, match, "dead letter not listed")
+}
+
+func discardDeadLetter(t *testing.T, deadLetterID string) {
+	t.Helper()
+
+	httpReq, err := http.NewRequest(http.MethodDelete, "http://localhost:8080/dead-letters/"+deadLetterID, nil)
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func assertDeadLetterNotFound(t *testing.T, deadLetterID string) {
+	t.Helper()
+
+	resp, err := http.Get("http://localhost:8080/dead-letters/" + deadLetterID)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func postJSON(t *testing.T, url string, body any) *http.Response {
+	t.Helper()
+
+	payload, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(payload))
+	require.NoError(t, err)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = resp.Body.Close()
+	})
+
+	return resp
+}
+
+func createShow(t *testing.T, deadNationID string, numberOfTickets uint) string {
+	t.Helper()
+
+	return postShow(t, newShowRequest(deadNationID, numberOfTickets))
+}
+
+func createNonRefundableShow(t *testing.T, deadNationID string, numberOfTickets uint) string {
+	t.Helper()
+
+	req := newShowRequest(deadNationID, numberOfTickets)
+	req["non_refundable"] = true
+
+	return postShow(t, req)
+}
+
+func newShowRequest(deadNationID string, numberOfTickets uint) map[string]any {
+	return map[string]any{
+		"dead_nation_id":    deadNationID,
+		"number_of_tickets": numberOfTickets,
+		"start_time":        time.Now().Add(24 * time.Hour).UTC(),
+		"title":             "Test show",
+		"venue":             "Test venue",
+	}
+}
+
+func postShow(t *testing.T, req map[string]any) string {
+	t.Helper()
+
+	resp := postJSON(t, "http://localhost:8080/shows", req)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var body struct {
+		ShowID string `json:"show_id"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	return body.ShowID
+}
+
+func bookTickets(t *testing.T, showID string, numberOfTickets uint) string {
+	t.Helper()
+
+	resp := postJSON(t, "http://localhost:8080/book-tickets", map[string]any{
+		"show_id":           showID,
+		"number_of_tickets": numberOfTickets,
+		"customer_email":    "someone@example.com",
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var body struct {
+		BookingID string `json:"booking_id"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	return body.BookingID
+}
+
+func holdSeats(t *testing.T, showID string, numberOfTickets uint) string {
+	t.Helper()
+
+	resp := postJSON(t, "http://localhost:8080/shows/"+showID+"/holds", map[string]any{
+		"number_of_tickets": numberOfTickets,
+		"customer_email":    "someone@example.com",
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var body struct {
+		HoldID string `json:"hold_id"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	return body.HoldID
+}
+
+func confirmSeatHold(t *testing.T, holdID string) string {
+	t.Helper()
+
+	resp := postJSON(t, "http://localhost:8080/holds/"+holdID+"/confirm", nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var body struct {
+		BookingID string `json:"booking_id"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	return body.BookingID
+}
+
+func assertTicketsAvailable(t *testing.T, showID string, ticketsAvailable uint) {
+	t.Helper()
+
+	resp, err := http.Get("http://localhost:8080/shows/" + showID)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var show struct {
+		TicketsAvailable uint `json:"tickets_available"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&show))
+
+	assert.Equal(t, ticketsAvailable, show.TicketsAvailable)
+}
+
+func cancelBooking(t *testing.T, bookingID string) {
+	t.Helper()
+
+	httpReq, err := http.NewRequest(http.MethodDelete, "http://localhost:8080/bookings/"+bookingID, nil)
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func joinWaitlist(t *testing.T, showID string, numberOfTickets uint) string {
+	t.Helper()
+
+	resp := postJSON(t, "http://localhost:8080/shows/"+showID+"/waitlist", map[string]any{
+		"number_of_tickets": numberOfTickets,
+		"customer_email":    "waiting@example.com",
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var body struct {
+		EntryID string `json:"entry_id"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	return body.EntryID
+}
+
+// assertWaitlistEntryStatus waits for the entry to reach status and returns its hold ID.
+func assertWaitlistEntryStatus(t *testing.T, entryID, status string) string {
+	t.Helper()
+
+	var holdID string
+	assert.EventuallyWithT(
+		t,
+		func(c *assert.CollectT) {
+			resp, err := http.Get("http://localhost:8080/waitlist/" + entryID)
+			require.NoError(c, err)
+			defer resp.Body.Close()
+			require.Equal(c, http.StatusOK, resp.StatusCode)
+
+			var entry struct {
+				Status string `json:"status"`
+				HoldID string `json:"hold_id"`
+			}
+			require.NoError(c, json.NewDecoder(resp.Body).Decode(&entry))
+
+			assert.Equal(c, status, entry.Status)
+			holdID = entry.HoldID
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+
+	return holdID
+}
+
+func assertBookingSagaStatus(t *testing.T, bookingID, status string) {
+	t.Helper()
+
+	assert.EventuallyWithT(
+		t,
+		func(c *assert.CollectT) {
+			resp, err := http.Get("http://localhost:8080/bookings/" + bookingID + "/saga")
+			require.NoError(c, err)
+			defer resp.Body.Close()
+			require.Equal(c, http.StatusOK, resp.StatusCode)
+
+			var saga struct {
+				Status string `json:"status"`
+			}
+			require.NoError(c, json.NewDecoder(resp.Body).Decode(&saga))
+
+			assert.Equal(c, status, saga.Status)
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+}
+
+func refundTicket(t *testing.T, ticketID string) string {
+	t.Helper()
+
+	return refundTicketWithKey(t, ticketID, uuid.NewString())
+}
+
+func refundTicketWithKey(t *testing.T, ticketID, idempotencyKey string) string {
+	t.Helper()
+
+	httpReq, err := http.NewRequest(http.MethodPut, "http://localhost:8080/ticket-refund/"+ticketID, nil)
+	require.NoError(t, err)
+	httpReq.Header.Set("Idempotency-Key", idempotencyKey)
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	var body struct {
+		RefundID string `json:"refund_id"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	return body.RefundID
+}
+
+func refundTicketRejected(t *testing.T, ticketID string) string {
+	t.Helper()
+
+	httpReq, err := http.NewRequest(http.MethodPut, "http://localhost:8080/ticket-refund/"+ticketID, nil)
+	require.NoError(t, err)
+	httpReq.Header.Set("Idempotency-Key", uuid.NewString())
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	var body struct {
+		Rule string `json:"rule"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	return body.Rule
+}
+
+func assertPaymentRefunded(t *testing.T, refunder *MockTicketRefunder, ticketID string, amount *entity.Money) {
+	t.Helper()
+
+	assert.EventuallyWithT(
+		t,
+		func(c *assert.CollectT) {
+			refunded, ok := refunder.AmountFor(ticketID)
+			require.True(c, ok, "payment not refunded")
+			assert.Equal(c, amount, refunded)
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+}
+
+func assertRefundStatus(t *testing.T, refundID, status string) {
+	t.Helper()
+
+	assert.EventuallyWithT(
+		t,
+		func(c *assert.CollectT) {
+			resp, err := http.Get("http://localhost:8080/refunds/" + refundID)
+			require.NoError(c, err)
+			defer resp.Body.Close()
+			require.Equal(c, http.StatusOK, resp.StatusCode)
+
+			var refund struct {
+				Status string `json:"status"`
+			}
+			require.NoError(c, json.NewDecoder(resp.Body).Decode(&refund))
+
+			assert.Equal(c, status, refund.Status)
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+}
+
+func assertHandlerSpanInRequestTrace(t *testing.T, exporter *tracetest.InMemoryExporter, requestSpanName, handlerSpanName string) {
+	t.Helper()
+
+	assert.EventuallyWithT(
+		t,
+		func(c *assert.CollectT) {
+			requestTraces := map[string]bool{}
+			for _, span := range exporter.GetSpans() {
+				if span.Name == requestSpanName {
+					requestTraces[span.SpanContext.TraceID().String()] = true
+				}
+			}
+			require.NotEmpty(c, requestTraces, "no request span")
+
+			var match bool
+			for _, span := range exporter.GetSpans() {
+				if span.Name == handlerSpanName && requestTraces[span.SpanContext.TraceID().String()] {
+					match = true
+				}
+			}
+			assert.True(c, match, "no handler span in request trace")
+		},
+		1*time.Second,
+		10*time.Millisecond,
+	)
+}
+
+func assertMetricExported(t *testing.T, metric string) {
+	t.Helper()
+
+	assert.EventuallyWithT(
+		t,
+		func(c *assert.CollectT) {
+			resp, err := http.Get("http://localhost:8080/metrics")
+			require.NoError(c, err)
+			defer resp.Body.Close()
+			require.Equal(c, http.StatusOK, resp.StatusCode)
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(c, err)
+
+			assert.Contains(c, string(body), metric)
+		},
+		1*time.Second,
+		10*time.Millisecond,
+	)
+}
+
+func assertDeadNationCancellationAppended(t *testing.T, spreadsheetAppender *MockSpreadsheetAppender, bookingID string) {
+	t.Helper()
+
+	assert.EventuallyWithT(
+		t,
+		func(c *assert.CollectT) {
+			req, ok := spreadsheetAppender.RequestFor("dead-nation-bookings-to-cancel", bookingID)
+			require.True(c, ok)
+
+			assert.Len(c, req.row, 4)
+			assert.Equal(c, "4", req.row[2])
+		},
+		1*time.Second,
+		10*time.Millisecond,
+	)
+}
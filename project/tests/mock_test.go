@@ -121,14 +121,64 @@ func (m *MockSpreadsheetAppender) RequestFor(spreadsheetName, ticketID string) (
 	return match, ok
 }
 
-type MockDeadNationBooker struct{}
+type rejectedError struct{}
+
+func (rejectedError) Error() string {
+	return "rejected"
+}
+
+func (rejectedError) Permanent() bool {
+	return true
+}
+
+type MockDeadNationBooker struct {
+	lock     sync.Mutex
+	rejected map[string]bool
+}
+
+func (m *MockDeadNationBooker) Reject(deadNationID string) {
+	m.lock.Lock()
+	if m.rejected == nil {
+		m.rejected = map[string]bool{}
+	}
+	m.rejected[deadNationID] = true
+	m.lock.Unlock()
+}
 
 func (m *MockDeadNationBooker) CreateBooking(ctx context.Context, deadNationID string, booking entity.Booking) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.rejected[deadNationID] {
+		return rejectedError{}
+	}
+
 	return nil
 }
 
-type MockTicketRefunder struct{}
+type MockTicketRefunder struct {
+	lock    sync.Mutex
+	amounts map[string]*entity.Money
+}
+
+func (m *MockTicketRefunder) RefundPayment(ctx context.Context, idempotencyKey string, ticketID string, amount *entity.Money) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.amounts == nil {
+		m.amounts = make(map[string]*entity.Money)
+	}
+	m.amounts[ticketID] = amount
 
-func (m *MockTicketRefunder) RefundPayment(ctx context.Context, idempotencyKey string, ticketID string) error {
 	return nil
 }
+
+// AmountFor returns the amount refunded for the ticket, nil for the whole
+// price, and whether it was refunded at all.
+func (m *MockTicketRefunder) AmountFor(ticketID string) (*entity.Money, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	amount, ok := m.amounts[ticketID]
+	return amount, ok
+}
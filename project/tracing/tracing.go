@@ -0,0 +1,117 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName = "tickets"
+	tracerName  = "tickets"
+)
+
+// NewExporter exports spans over OTLP when OTEL_EXPORTER_OTLP_ENDPOINT is set,
+// and to stdout when TRACING_STDOUT is "true". Otherwise it returns nil and
+// spans are recorded but not exported.
+func NewExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" {
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("creating otlp exporter: %w", err)
+		}
+
+		return exporter, nil
+	}
+
+	if os.Getenv("TRACING_STDOUT") == "true" {
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("creating stdout exporter: %w", err)
+		}
+
+		return exporter, nil
+	}
+
+	return nil, nil
+}
+
+// Init installs a global tracer provider exporting to exporter, which may be
+// nil, and the W3C trace context propagator.
+func Init(exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return tp
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// RecordError marks the span as failed when err is not nil.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// InjectToMessage stores the trace context of ctx in the message metadata.
+func InjectToMessage(ctx context.Context, msg *message.Message) {
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(msg.Metadata))
+}
+
+// ExtractFromMessage returns ctx with the trace context stored in the message metadata.
+func ExtractFromMessage(ctx context.Context, msg *message.Message) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(msg.Metadata))
+}
+
+func MessagingAttributes(topic string, msg *message.Message) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.MessagingSystemKey.String("watermill"),
+		semconv.MessagingDestinationName(topic),
+		semconv.MessagingMessageID(msg.UUID),
+	}
+}
+
+type metadataCarrier message.Metadata
+
+func (c metadataCarrier) Get(key string) string {
+	return message.Metadata(c).Get(key)
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	message.Metadata(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+
+	return keys
+}